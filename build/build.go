@@ -0,0 +1,93 @@
+// Package build exposes metadata about how the running binary was built. Values
+// injected at link time take precedence over those embedded by the Go toolchain, for
+// example:
+//
+//	go build -ldflags "-X github.com/usvc/go-server/build.Version=1.2.3 \
+//	  -X github.com/usvc/go-server/build.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/usvc/go-server/build.Timestamp=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package build
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// DefaultVersion is the version reported when none is injected at link time and the
+// main module was not built from a tagged version
+const DefaultVersion = "development"
+
+var (
+	// Commit is the VCS revision the binary was built from, set using -ldflags
+	Commit string
+	// Dirty is "true" if the binary was built with uncommitted changes, set using -ldflags
+	Dirty string
+	// Timestamp is the time at which the binary was built, set using -ldflags
+	Timestamp string
+	// Version is the version of the binary, set using -ldflags
+	Version string
+)
+
+// Info describes how the running binary was built
+type Info struct {
+	Version      string       `json:"version"`
+	Commit       string       `json:"commit"`
+	Dirty        bool         `json:"dirty"`
+	BuildTime    string       `json:"buildTime,omitempty"`
+	CommitTime   string       `json:"commitTime,omitempty"`
+	GoVersion    string       `json:"goVersion"`
+	Path         string       `json:"path,omitempty"`
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+}
+
+// Dependency describes a module the binary was built with
+type Dependency struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Replace string `json:"replace,omitempty"`
+}
+
+// GetInfo returns the build information of the running binary from the variables
+// injected at link time, falling back to the information embedded by the Go toolchain
+func GetInfo() Info {
+	info := Info{GoVersion: runtime.Version()}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		info.Path = buildInfo.Main.Path
+		if buildInfo.Main.Version != "(devel)" {
+			info.Version = buildInfo.Main.Version
+		}
+		setVCSInfo(&info, buildInfo)
+		for _, module := range buildInfo.Deps {
+			dependency := Dependency{Path: module.Path, Version: module.Version}
+			if module.Replace != nil {
+				dependency.Replace = module.Replace.Path
+				if len(module.Replace.Version) > 0 {
+					dependency.Replace += "@" + module.Replace.Version
+				}
+			}
+			info.Dependencies = append(info.Dependencies, dependency)
+		}
+	}
+	if len(Version) > 0 {
+		info.Version = Version
+	}
+	if len(info.Version) == 0 {
+		info.Version = DefaultVersion
+	}
+	if len(Commit) > 0 {
+		info.Commit = Commit
+	}
+	if len(Dirty) > 0 {
+		info.Dirty = Dirty == "true"
+	}
+	info.BuildTime = Timestamp
+	return info
+}
+
+// GetRevision returns the commit of :info, suffixed with "-dirty" if the binary was
+// built with uncommitted changes
+func (info Info) GetRevision() string {
+	if info.Dirty && len(info.Commit) > 0 {
+		return info.Commit + "-dirty"
+	}
+	return info.Commit
+}
@@ -0,0 +1,42 @@
+package build
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type BuildTests struct {
+	suite.Suite
+}
+
+func TestBuild(t *testing.T) {
+	suite.Run(t, &BuildTests{})
+}
+
+func (s BuildTests) Test_GetInfo() {
+	info := GetInfo()
+	s.Equal(runtime.Version(), info.GoVersion)
+	s.NotEmpty(info.Version)
+	s.Empty(info.BuildTime)
+}
+
+func (s BuildTests) Test_GetInfo_ldflags() {
+	defer func(version, commit, dirty, timestamp string) {
+		Version, Commit, Dirty, Timestamp = version, commit, dirty, timestamp
+	}(Version, Commit, Dirty, Timestamp)
+	Version = "1.2.3"
+	Commit = "abcdef"
+	Dirty = "true"
+	Timestamp = "2020-01-02T03:04:05Z"
+	info := GetInfo()
+	s.Equal("1.2.3", info.Version)
+	s.Equal("abcdef", info.Commit)
+	s.True(info.Dirty)
+	s.Equal("2020-01-02T03:04:05Z", info.BuildTime)
+	s.Equal("abcdef-dirty", info.GetRevision())
+
+	Dirty = "false"
+	s.Equal("abcdef", GetInfo().GetRevision())
+}
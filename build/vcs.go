@@ -0,0 +1,21 @@
+//go:build go1.18
+// +build go1.18
+
+package build
+
+import "runtime/debug"
+
+// setVCSInfo sets the commit details of :info from the VCS settings embedded in the
+// :buildInfo by the Go toolchain since Go 1.18
+func setVCSInfo(info *Info, buildInfo *debug.BuildInfo) {
+	for _, setting := range buildInfo.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Commit = setting.Value
+		case "vcs.modified":
+			info.Dirty = setting.Value == "true"
+		case "vcs.time":
+			info.CommitTime = setting.Value
+		}
+	}
+}
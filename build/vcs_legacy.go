@@ -0,0 +1,10 @@
+//go:build !go1.18
+// +build !go1.18
+
+package build
+
+import "runtime/debug"
+
+// setVCSInfo does nothing since the Go toolchain only embeds VCS settings from Go
+// 1.18, the commit details can still be set using -ldflags
+func setVCSInfo(info *Info, buildInfo *debug.BuildInfo) {}
@@ -0,0 +1,28 @@
+// Package checks provides ready-made health checks which can be used in liveness,
+// readiness and startup probes
+package checks
+
+import (
+	"time"
+
+	"github.com/usvc/go-server/types"
+)
+
+// DefaultTimeout is the timeout applied to checks which do not specify one
+const DefaultTimeout = time.Second
+
+// newCheck returns a check named :name (or :defaultName if :name is empty) which runs
+// :check with a context that expires after :timeout
+func newCheck(name, defaultName string, timeout time.Duration, check types.HTTPProbeContextHandler) types.HTTPProbeCheck {
+	if len(name) == 0 {
+		name = defaultName
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return types.HTTPProbeCheck{
+		Name:           name,
+		Timeout:        timeout,
+		ContextHandler: check,
+	}
+}
@@ -0,0 +1,34 @@
+package checks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ChecksTests struct {
+	suite.Suite
+}
+
+func TestChecks(t *testing.T) {
+	suite.Run(t, &ChecksTests{})
+}
+
+func (s ChecksTests) Test_newCheck() {
+	check := newCheck("", "expected-default", 0, func(context.Context) error { return nil })
+	s.Equal("expected-default", check.Name)
+	s.Equal(DefaultTimeout, check.Timeout)
+
+	check = newCheck("expected", "unexpected", time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	s.Equal("expected", check.Name)
+	s.Equal(time.Millisecond, check.Timeout)
+	s.EqualError(check.Do(), "expected: timed out after 1ms")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.EqualError(check.ContextHandler(ctx), "context canceled", "the handler should use the provided context")
+}
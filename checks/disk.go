@@ -0,0 +1,35 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/usvc/go-server/types"
+)
+
+type DiskFreeConfiguration struct {
+	// Name identifies the check, defaults to "disk"
+	Name string
+	// Timeout is the maximum duration of the check, defaults to DefaultTimeout
+	Timeout time.Duration
+	// Path is a path on the filesystem to check
+	Path string
+	// MinimumBytes is the amount of free space below which the check fails
+	MinimumBytes uint64
+}
+
+// NewDiskFree returns a check that passes if the filesystem containing the
+// configured path has at least the configured amount of space available
+func NewDiskFree(conf DiskFreeConfiguration) types.HTTPProbeCheck {
+	return newCheck(conf.Name, "disk", conf.Timeout, func(ctx context.Context) error {
+		available, err := getDiskFreeBytes(conf.Path)
+		if err != nil {
+			return err
+		}
+		if available < conf.MinimumBytes {
+			return fmt.Errorf("'%s' has %v bytes available which is below the minimum of %v", conf.Path, available, conf.MinimumBytes)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,15 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !windows
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!windows
+
+package checks
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// getDiskFreeBytes returns an error since the free space of a filesystem cannot be
+// retrieved on this platform
+func getDiskFreeBytes(path string) (uint64, error) {
+	return 0, fmt.Errorf("disk free space is not supported on the %s platform", runtime.GOOS)
+}
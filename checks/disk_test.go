@@ -0,0 +1,23 @@
+package checks
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+func (s ChecksTests) Test_NewDiskFree() {
+	directory, err := ioutil.TempDir("", "go-server-checks")
+	s.Nil(err)
+	defer os.RemoveAll(directory)
+
+	check := NewDiskFree(DiskFreeConfiguration{Path: directory, MinimumBytes: 1})
+	s.Equal("disk", check.Name)
+	s.Nil(check.Do())
+
+	check = NewDiskFree(DiskFreeConfiguration{Path: directory, MinimumBytes: math.MaxUint64})
+	s.Contains(check.Do().Error(), "below the minimum")
+
+	check = NewDiskFree(DiskFreeConfiguration{Path: directory + "/missing"})
+	s.NotNil(check.Do())
+}
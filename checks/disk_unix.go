@@ -0,0 +1,16 @@
+//go:build aix || darwin || dragonfly || freebsd || linux
+// +build aix darwin dragonfly freebsd linux
+
+package checks
+
+import "syscall"
+
+// getDiskFreeBytes returns the number of bytes available to unprivileged users on
+// the filesystem containing :path
+func getDiskFreeBytes(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,25 @@
+//go:build windows
+// +build windows
+
+package checks
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// getDiskFreeBytes returns the number of bytes available to the calling user on
+// the volume containing :path
+func getDiskFreeBytes(path string) (uint64, error) {
+	pathPointer, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	getDiskFreeSpaceEx := syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+	var available uint64
+	result, _, err := getDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(pathPointer)), uintptr(unsafe.Pointer(&available)), 0, 0)
+	if result == 0 {
+		return 0, err
+	}
+	return available, nil
+}
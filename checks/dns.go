@@ -0,0 +1,40 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/usvc/go-server/types"
+)
+
+type DNSResolveConfiguration struct {
+	// Name identifies the check, defaults to "dns"
+	Name string
+	// Timeout is the maximum duration of the check, defaults to DefaultTimeout
+	Timeout time.Duration
+	// Host is the hostname to resolve
+	Host string
+	// Resolver is used to resolve the host, defaults to net.DefaultResolver
+	Resolver *net.Resolver
+}
+
+// NewDNSResolve returns a check that passes if the configured host resolves to
+// at least one address
+func NewDNSResolve(conf DNSResolveConfiguration) types.HTTPProbeCheck {
+	resolver := conf.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return newCheck(conf.Name, "dns", conf.Timeout, func(ctx context.Context) error {
+		addresses, err := resolver.LookupHost(ctx, conf.Host)
+		if err != nil {
+			return err
+		}
+		if len(addresses) == 0 {
+			return fmt.Errorf("no addresses found for '%s'", conf.Host)
+		}
+		return nil
+	})
+}
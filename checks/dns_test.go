@@ -0,0 +1,10 @@
+package checks
+
+func (s ChecksTests) Test_NewDNSResolve() {
+	check := NewDNSResolve(DNSResolveConfiguration{Host: "localhost"})
+	s.Equal("dns", check.Name)
+	s.Nil(check.Do())
+
+	check = NewDNSResolve(DNSResolveConfiguration{Host: "unresolvable.invalid"})
+	s.NotNil(check.Do())
+}
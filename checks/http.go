@@ -0,0 +1,55 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/usvc/go-server/types"
+)
+
+type HTTPGetConfiguration struct {
+	// Name identifies the check, defaults to "http"
+	Name string
+	// Timeout is the maximum duration of the check, defaults to DefaultTimeout
+	Timeout time.Duration
+	// URL is the address to send the GET request to
+	URL string
+	// ExpectedStatus is the response status code required for the check to
+	// pass, defaults to http.StatusOK
+	ExpectedStatus int
+	// Client is used to send the request, defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// NewHTTPGet returns a check that passes if a GET request to the configured
+// URL responds with the expected status code
+func NewHTTPGet(conf HTTPGetConfiguration) types.HTTPProbeCheck {
+	expectedStatus := conf.ExpectedStatus
+	if expectedStatus == 0 {
+		expectedStatus = http.StatusOK
+	}
+	client := conf.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return newCheck(conf.Name, "http", conf.Timeout, func(ctx context.Context) error {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, conf.URL, nil)
+		if err != nil {
+			return err
+		}
+		response, err := client.Do(request)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		io.Copy(ioutil.Discard, response.Body)
+		if response.StatusCode != expectedStatus {
+			return fmt.Errorf("expected status %v but received %v", expectedStatus, response.StatusCode)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,28 @@
+package checks
+
+import (
+	"net/http"
+	"net/http/httptest"
+)
+
+func (s ChecksTests) Test_NewHTTPGet() {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler.HandleFunc("/teapot", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	check := NewHTTPGet(HTTPGetConfiguration{URL: server.URL + "/ok"})
+	s.Equal("http", check.Name)
+	s.Nil(check.Do())
+
+	check = NewHTTPGet(HTTPGetConfiguration{URL: server.URL + "/teapot"})
+	s.EqualError(check.Do(), "http: expected status 200 but received 418")
+
+	check = NewHTTPGet(HTTPGetConfiguration{URL: server.URL + "/teapot", ExpectedStatus: http.StatusTeapot})
+	s.Nil(check.Do())
+}
@@ -0,0 +1,60 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/usvc/go-server/types"
+)
+
+type GoroutinesConfiguration struct {
+	// Name identifies the check, defaults to "goroutines"
+	Name string
+	// Timeout is the maximum duration of the check, defaults to DefaultTimeout
+	Timeout time.Duration
+	// Maximum is the number of goroutines above which the check fails, the check
+	// always passes if this is not set
+	Maximum int
+}
+
+// NewGoroutines returns a check that passes if the number of goroutines does
+// not exceed the configured maximum
+func NewGoroutines(conf GoroutinesConfiguration) types.HTTPProbeCheck {
+	return newCheck(conf.Name, "goroutines", conf.Timeout, func(ctx context.Context) error {
+		if conf.Maximum <= 0 {
+			return nil
+		}
+		if count := runtime.NumGoroutine(); count > conf.Maximum {
+			return fmt.Errorf("%v goroutines exceeds the maximum of %v", count, conf.Maximum)
+		}
+		return nil
+	})
+}
+
+type HeapConfiguration struct {
+	// Name identifies the check, defaults to "heap"
+	Name string
+	// Timeout is the maximum duration of the check, defaults to DefaultTimeout
+	Timeout time.Duration
+	// MaximumBytes is the size of allocated heap objects above which the check fails,
+	// the check always passes if this is not set
+	MaximumBytes uint64
+}
+
+// NewHeap returns a check that passes if the bytes allocated to heap objects do
+// not exceed the configured maximum
+func NewHeap(conf HeapConfiguration) types.HTTPProbeCheck {
+	return newCheck(conf.Name, "heap", conf.Timeout, func(ctx context.Context) error {
+		if conf.MaximumBytes == 0 {
+			return nil
+		}
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		if stats.HeapAlloc > conf.MaximumBytes {
+			return fmt.Errorf("%v heap bytes exceeds the maximum of %v", stats.HeapAlloc, conf.MaximumBytes)
+		}
+		return nil
+	})
+}
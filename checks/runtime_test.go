@@ -0,0 +1,27 @@
+package checks
+
+import "math"
+
+func (s ChecksTests) Test_NewGoroutines() {
+	check := NewGoroutines(GoroutinesConfiguration{Maximum: math.MaxInt32})
+	s.Equal("goroutines", check.Name)
+	s.Nil(check.Do())
+
+	check = NewGoroutines(GoroutinesConfiguration{Maximum: 1})
+	s.Contains(check.Do().Error(), "exceeds the maximum of 1")
+
+	check = NewGoroutines(GoroutinesConfiguration{})
+	s.Nil(check.Do(), "an unset maximum should not fail the check")
+}
+
+func (s ChecksTests) Test_NewHeap() {
+	check := NewHeap(HeapConfiguration{MaximumBytes: math.MaxUint64})
+	s.Equal("heap", check.Name)
+	s.Nil(check.Do())
+
+	check = NewHeap(HeapConfiguration{MaximumBytes: 1})
+	s.Contains(check.Do().Error(), "exceeds the maximum of 1")
+
+	check = NewHeap(HeapConfiguration{})
+	s.Nil(check.Do(), "an unset maximum should not fail the check")
+}
@@ -0,0 +1,26 @@
+package checks
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/usvc/go-server/types"
+)
+
+type SQLPingConfiguration struct {
+	// Name identifies the check, defaults to "sql"
+	Name string
+	// Timeout is the maximum duration of the check, defaults to DefaultTimeout
+	Timeout time.Duration
+	// DB is the database connection pool to ping
+	DB *sql.DB
+}
+
+// NewSQLPing returns a check that passes if the configured database responds
+// to a ping
+func NewSQLPing(conf SQLPingConfiguration) types.HTTPProbeCheck {
+	return newCheck(conf.Name, "sql", conf.Timeout, func(ctx context.Context) error {
+		return conf.DB.PingContext(ctx)
+	})
+}
@@ -0,0 +1,59 @@
+package checks
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+)
+
+// testDriverInstance is registered once as the "checks_test" driver because
+// sql.Register panics if a driver name is registered twice
+var testDriverInstance = &testDriver{}
+
+func init() {
+	sql.Register("checks_test", testDriverInstance)
+}
+
+type testDriver struct {
+	pingError error
+}
+
+func (td *testDriver) Open(string) (driver.Conn, error) {
+	return testConnection{td}, nil
+}
+
+type testConnection struct {
+	driver *testDriver
+}
+
+func (tc testConnection) Prepare(string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (tc testConnection) Close() error {
+	return nil
+}
+
+func (tc testConnection) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (tc testConnection) Ping(context.Context) error {
+	return tc.driver.pingError
+}
+
+func (s ChecksTests) Test_NewSQLPing() {
+	testDriverInstance.pingError = nil
+	db, err := sql.Open("checks_test", "")
+	s.Nil(err)
+	defer db.Close()
+
+	check := NewSQLPing(SQLPingConfiguration{DB: db})
+	s.Equal("sql", check.Name)
+	s.Nil(check.Do())
+
+	testDriverInstance.pingError = fmt.Errorf("expected ping error")
+	db.SetMaxIdleConns(0)
+	s.EqualError(check.Do(), "sql: expected ping error")
+}
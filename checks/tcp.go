@@ -0,0 +1,31 @@
+package checks
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/usvc/go-server/types"
+)
+
+type TCPDialConfiguration struct {
+	// Name identifies the check, defaults to "tcp"
+	Name string
+	// Timeout is the maximum duration of the check, defaults to DefaultTimeout
+	Timeout time.Duration
+	// Address is the host:port to dial
+	Address string
+}
+
+// NewTCPDial returns a check that passes if a TCP connection can be opened to
+// the configured address
+func NewTCPDial(conf TCPDialConfiguration) types.HTTPProbeCheck {
+	return newCheck(conf.Name, "tcp", conf.Timeout, func(ctx context.Context) error {
+		var dialer net.Dialer
+		connection, err := dialer.DialContext(ctx, "tcp", conf.Address)
+		if err != nil {
+			return err
+		}
+		return connection.Close()
+	})
+}
@@ -0,0 +1,19 @@
+package checks
+
+import (
+	"net"
+)
+
+func (s ChecksTests) Test_NewTCPDial() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Nil(err)
+	check := NewTCPDial(TCPDialConfiguration{Address: listener.Addr().String()})
+	s.Equal("tcp", check.Name)
+	s.Nil(check.Do())
+
+	listener.Close()
+	check = NewTCPDial(TCPDialConfiguration{Name: "expected", Address: listener.Addr().String()})
+	err = check.Do()
+	s.NotNil(err)
+	s.Contains(err.Error(), "expected: ")
+}
@@ -5,6 +5,7 @@ go 1.15
 require (
 	github.com/google/uuid v1.2.0
 	github.com/prometheus/client_golang v1.9.0
+	github.com/prometheus/client_model v0.2.0
 	github.com/sirupsen/logrus v1.7.0
 	github.com/spf13/cobra v0.0.3
 	github.com/stretchr/testify v1.4.0
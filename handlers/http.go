@@ -1,8 +1,6 @@
 package handlers
 
 import (
-	"encoding/json"
-	"fmt"
 	"net/http"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -17,63 +15,43 @@ const (
 )
 
 func GetHTTPLivenessProbe(handlers types.HTTPProbeHandlers) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Add("Content-Type", "application/json")
-		if errs := handlers.Do(); errs != nil {
-			reportedErrors := []string{}
-			for _, err := range errs {
-				reportedErrors = append(reportedErrors, err.Error())
-			}
-			errsAsJSON, marshalError := json.Marshal(reportedErrors)
-			w.WriteHeader(http.StatusInternalServerError)
-			if marshalError != nil {
-				w.Write([]byte(fmt.Sprintf("\"%s\"", marshalError.Error())))
-				return
-			}
-			w.Write(errsAsJSON)
-			return
-		}
-		w.WriteHeader(ProbeResponseCodeSuccess)
-		w.Write([]byte(ProbeResponseOK))
-	}
+	return NewHTTPProbe(HTTPProbeConfiguration{
+		Type:     ProbeTypeLiveness,
+		Handlers: handlers,
+	}).ServeHTTP
 }
 
+// GetHTTPMetrics returns a handler which serves the metrics of the first :collector,
+// or of the default registry if none is provided. Responses are in the OpenMetrics
+// format (which includes exemplars) if the request accepts it and in the Prometheus
+// text format otherwise
 func GetHTTPMetrics(collector ...prometheus.Gatherer) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if len(collector) == 0 {
-			promhttp.Handler().ServeHTTP(w, r)
-			return
-		}
-		promhttp.HandlerFor(collector[0], promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	opts := promhttp.HandlerOpts{EnableOpenMetrics: true}
+	if len(collector) == 0 {
+		return promhttp.InstrumentMetricHandler(
+			prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(prometheus.DefaultGatherer, opts),
+		).ServeHTTP
 	}
+	return promhttp.HandlerFor(collector[0], opts).ServeHTTP
 }
 
 func GetHTTPReadinessProbe(handlers types.HTTPProbeHandlers) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Add("Content-Type", "application/json")
-		if errs := handlers.Do(); errs != nil {
-			reportedErrors := []string{}
-			for _, err := range errs {
-				reportedErrors = append(reportedErrors, err.Error())
-			}
-			errsAsJSON, marshalError := json.Marshal(reportedErrors)
-			w.WriteHeader(http.StatusInternalServerError)
-			if marshalError != nil {
-				w.Write([]byte(fmt.Sprintf("\"%s\"", marshalError.Error())))
-				return
-			}
-			w.Write(errsAsJSON)
-			return
-		}
-		w.WriteHeader(ProbeResponseCodeSuccess)
-		w.Write([]byte(ProbeResponseOK))
-	}
+	return NewHTTPProbe(HTTPProbeConfiguration{
+		Type:     ProbeTypeReadiness,
+		Handlers: handlers,
+	}).ServeHTTP
 }
 
+func GetHTTPStartupProbe(handlers types.HTTPProbeHandlers) http.HandlerFunc {
+	return NewHTTPProbe(HTTPProbeConfiguration{
+		Type:     ProbeTypeStartup,
+		Handlers: handlers,
+		Latch:    true,
+	}).ServeHTTP
+}
+
+// GetHTTPVersion returns a handler which responds with :version, see NewHTTPVersion
 func GetHTTPVersion(version string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(version))
-	}
+	return NewHTTPVersion(HTTPVersionConfiguration{Value: version})
 }
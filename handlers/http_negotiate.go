@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// negotiateContentType returns the content type from :offers which is most preferred by
+// the Accept header of the request :r. Offers are listed in order of the server's
+// preference, which is used to break ties. The first offer is returned when the request
+// has no Accept header or accepts none of the offers
+func negotiateContentType(r *http.Request, offers ...string) string {
+	accept := r.Header.Values("Accept")
+	if len(accept) == 0 {
+		return offers[0]
+	}
+	type acceptedRange struct {
+		mediaType string
+		quality   float64
+	}
+	ranges := []acceptedRange{}
+	for _, header := range accept {
+		for _, entry := range strings.Split(header, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(entry))
+			if err != nil {
+				continue
+			}
+			quality := float64(1)
+			if q, ok := params["q"]; ok {
+				if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+					quality = parsed
+				}
+			}
+			ranges = append(ranges, acceptedRange{mediaType, quality})
+		}
+	}
+	best := offers[0]
+	bestQuality := float64(0)
+	for _, offer := range offers {
+		offerType := strings.SplitN(offer, "/", 2)[0]
+		quality, specificity := float64(0), -1
+		for _, accepted := range ranges {
+			matchSpecificity := -1
+			switch accepted.mediaType {
+			case offer:
+				matchSpecificity = 2
+			case offerType + "/*":
+				matchSpecificity = 1
+			case "*/*":
+				matchSpecificity = 0
+			}
+			if matchSpecificity > specificity {
+				quality, specificity = accepted.quality, matchSpecificity
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+	return best
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type NegotiateTests struct {
+	suite.Suite
+}
+
+func TestNegotiate(t *testing.T) {
+	suite.Run(t, &NegotiateTests{})
+}
+
+func (s NegotiateTests) Test_negotiateContentType() {
+	offers := []string{"application/json", "application/health+json", "text/plain"}
+	testCases := map[string]string{
+		"":                                "application/json",
+		"*/*":                             "application/json",
+		"application/health+json":         "application/health+json",
+		"text/*":                          "text/plain",
+		"text/html":                       "application/json",
+		"application/*;q=0.5, text/plain": "text/plain",
+		"application/health+json;q=0.9, application/json;q=0.8": "application/health+json",
+		"application/json;q=0, */*":                             "application/health+json",
+		"text/plain, application/health+json":                   "application/health+json",
+	}
+	for accept, expected := range testCases {
+		request, err := http.NewRequest(http.MethodGet, "/", nil)
+		s.Nil(err)
+		if len(accept) > 0 {
+			request.Header.Set("Accept", accept)
+		}
+		s.Equal(expected, negotiateContentType(request, offers...), "accept: '%s'", accept)
+	}
+}
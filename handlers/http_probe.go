@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/usvc/go-server/types"
+)
+
+const (
+	ProbeTypeLiveness  = "liveness"
+	ProbeTypeReadiness = "readiness"
+	ProbeTypeStartup   = "startup"
+
+	ProbeStatusOK       = "ok"
+	ProbeStatusDegraded = "degraded"
+	ProbeStatusFailed   = "failed"
+
+	// ContentTypeHealthJSON is the media type of the draft IETF health check
+	// response format, ref: https://tools.ietf.org/html/draft-inadarei-api-health-check
+	ContentTypeHealthJSON = "application/health+json"
+	ContentTypeJSON       = "application/json"
+
+	HealthStatusPass = "pass"
+	HealthStatusWarn = "warn"
+	HealthStatusFail = "fail"
+
+	ProbeQueryExclude = "exclude"
+	ProbeQueryVerbose = "verbose"
+)
+
+type HTTPProbeConfiguration struct {
+	// Type identifies the kind of probe, use one of the ProbeType* constants
+	Type string
+	// Path is the path the probe is served at. When defined, each named check
+	// can be run individually at a subpath of this path named after the check
+	Path string
+	// Handlers are the unnamed checks run whenever the probe is requested
+	Handlers types.HTTPProbeHandlers
+	// Checks are the named checks run whenever the probe is requested after
+	// the unnamed Handlers
+	Checks types.HTTPProbeChecks
+	// Latch when set causes the probe to report success without running its
+	// handlers once they have all passed, as is expected of startup probes
+	Latch bool
+	// Startup when defined causes this probe to run the referenced startup probe
+	// until it has succeeded, reporting success without running its own handlers
+	// while the startup probe is failing
+	Startup *HTTPProbe
+	// Metrics when defined receives the results of named checks
+	Metrics *HTTPProbeMetrics
+	// Version is reported in application/health+json responses
+	Version string
+	// ServiceID is reported in application/health+json responses
+	ServiceID string
+}
+
+// NewHTTPProbe returns a probe handler that runs the handlers and checks defined in :config
+func NewHTTPProbe(config HTTPProbeConfiguration) *HTTPProbe {
+	checks := []*httpProbeCheck{}
+	for _, handler := range config.Handlers {
+		checks = append(checks, &httpProbeCheck{HTTPProbeCheck: types.HTTPProbeCheck{Handler: handler}})
+	}
+	for _, check := range config.Checks {
+		checks = append(checks, &httpProbeCheck{HTTPProbeCheck: check})
+	}
+	if config.Metrics != nil {
+		config.Metrics.observeOverride(config.Type, false)
+	}
+	return &HTTPProbe{config: config, checks: checks}
+}
+
+// HTTPProbe is a http.Handler that reports on the results of its checks
+type HTTPProbe struct {
+	config    HTTPProbeConfiguration
+	checks    []*httpProbeCheck
+	override  *HTTPProbeOverride
+	mutex     sync.RWMutex
+	succeeded uint32
+}
+
+// AddCheck adds the named :check to the probe, it is safe to call this while the
+// probe is being served
+func (p *HTTPProbe) AddCheck(check types.HTTPProbeCheck) error {
+	if len(check.Name) == 0 {
+		return fmt.Errorf("checks added at runtime must be named")
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, existing := range p.checks {
+		if existing.Name == check.Name {
+			return fmt.Errorf("a check named '%s' already exists in the %s probe", check.Name, p.config.Type)
+		}
+	}
+	checks := make([]*httpProbeCheck, len(p.checks), len(p.checks)+1)
+	copy(checks, p.checks)
+	p.checks = append(checks, &httpProbeCheck{HTTPProbeCheck: check})
+	return nil
+}
+
+// RemoveCheck removes the check named :name from the probe and returns true if it
+// existed, it is safe to call this while the probe is being served
+func (p *HTTPProbe) RemoveCheck(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for index, existing := range p.checks {
+		if existing.Name == name {
+			checks := make([]*httpProbeCheck, 0, len(p.checks)-1)
+			checks = append(checks, p.checks[:index]...)
+			p.checks = append(checks, p.checks[index+1:]...)
+			if p.config.Metrics != nil {
+				p.config.Metrics.forget(p.config.Type, name)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// getChecks returns the current set of checks
+func (p *HTTPProbe) getChecks() []*httpProbeCheck {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.checks
+}
+
+// HTTPProbeReport is the outcome of a probe run
+type HTTPProbeReport struct {
+	// Status is one of the ProbeStatus* constants
+	Status string `json:"status"`
+	// Checks contains the outcome of each check that was run
+	Checks []HTTPProbeCheckReport `json:"checks,omitempty"`
+	// Excluded contains the names of checks which were excluded from the run
+	Excluded []string `json:"excluded,omitempty"`
+	// Override is the override which caused the probe to fail if any
+	Override *HTTPProbeOverride `json:"override,omitempty"`
+}
+
+// Errors returns the errors of checks which are not passing, preceded by the
+// override's error if the probe was overridden
+func (r HTTPProbeReport) Errors() []error {
+	var errs []error
+	if r.Override != nil {
+		errs = append(errs, r.Override.Err())
+	}
+	for _, check := range r.Checks {
+		if check.Error != nil {
+			errs = append(errs, check.Error)
+		}
+	}
+	return errs
+}
+
+// HTTPProbeCheckReport is the outcome of a single check in a probe run
+type HTTPProbeCheckReport struct {
+	Name        string        `json:"name,omitempty"`
+	Status      string        `json:"status"`
+	NonCritical bool          `json:"nonCritical,omitempty"`
+	Time        time.Time     `json:"time"`
+	Duration    time.Duration `json:"duration"`
+	// Error is the error of the check if it is considered failed after applying
+	// its thresholds
+	Error error `json:"-"`
+	// failed is true if the check failed in this run regardless of its thresholds
+	failed bool
+}
+
+// Succeeded returns true if the probe has latched as succeeded, this only
+// applies to probes configured with Latch
+func (p *HTTPProbe) Succeeded() bool {
+	return atomic.LoadUint32(&p.succeeded) == 1
+}
+
+// Do runs the checks of the probe and returns the errors of checks which are
+// not passing, including those of non-critical checks
+func (p *HTTPProbe) Do() []error {
+	return p.Run().Errors()
+}
+
+// Run runs the checks of the probe and returns a report of their outcomes
+func (p *HTTPProbe) Run() HTTPProbeReport {
+	return p.RunContext(context.Background())
+}
+
+// RunContext runs the checks of the probe with the context :ctx and returns a report
+// of their outcomes
+func (p *HTTPProbe) RunContext(ctx context.Context) HTTPProbeReport {
+	return p.run(ctx, func(*httpProbeCheck) bool { return true })
+}
+
+// run runs the checks of the probe for which :include returns true with the context
+// :ctx and returns a report of their outcomes, the probe's status is only recorded
+// and latched when every check was included
+func (p *HTTPProbe) run(ctx context.Context, include func(*httpProbeCheck) bool) HTTPProbeReport {
+	report := HTTPProbeReport{Status: ProbeStatusOK}
+	if p.config.Startup != nil && !p.config.Startup.Succeeded() {
+		if p.config.Startup.RunContext(ctx); !p.config.Startup.Succeeded() {
+			return report
+		}
+	}
+	if p.config.Latch && p.Succeeded() {
+		return report
+	}
+	for _, check := range p.getChecks() {
+		if !include(check) {
+			report.Excluded = append(report.Excluded, check.Name)
+			continue
+		}
+		checkReport := check.run(ctx)
+		if p.config.Metrics != nil && len(check.Name) > 0 {
+			p.config.Metrics.observe(p.config.Type, checkReport)
+		}
+		if checkReport.Error != nil {
+			if check.NonCritical {
+				if report.Status == ProbeStatusOK {
+					report.Status = ProbeStatusDegraded
+				}
+			} else {
+				report.Status = ProbeStatusFailed
+			}
+		}
+		report.Checks = append(report.Checks, checkReport)
+	}
+	if report.Override = p.GetOverride(); report.Override != nil {
+		report.Status = ProbeStatusFailed
+	}
+	if len(report.Excluded) > 0 {
+		// partial runs do not represent the state of the probe
+		return report
+	}
+	if p.config.Metrics != nil {
+		p.config.Metrics.observeStatus(p.config.Type, report.Status)
+	}
+	if report.Status != ProbeStatusFailed && p.config.Latch {
+		atomic.StoreUint32(&p.succeeded, 1)
+	}
+	return report
+}
+
+func (p *HTTPProbe) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var report HTTPProbeReport
+	if checkName := p.getCheckName(r); len(checkName) > 0 {
+		if p.getCheck(checkName) == nil {
+			w.Header().Add("Content-Type", ContentTypeJSON)
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(fmt.Sprintf("%q", fmt.Sprintf("check '%s' does not exist", checkName))))
+			return
+		}
+		report = p.run(r.Context(), func(check *httpProbeCheck) bool {
+			return check.Name == checkName
+		})
+		report.Excluded = nil
+	} else {
+		excluded := map[string]bool{}
+		for _, exclude := range r.URL.Query()[ProbeQueryExclude] {
+			for _, name := range strings.Split(exclude, ",") {
+				excluded[strings.TrimSpace(name)] = true
+			}
+		}
+		report = p.run(r.Context(), func(check *httpProbeCheck) bool {
+			return len(check.Name) == 0 || !excluded[check.Name]
+		})
+	}
+	if _, verbose := r.URL.Query()[ProbeQueryVerbose]; verbose {
+		p.writeVerbose(w, report)
+		return
+	}
+	if negotiateContentType(r, ContentTypeJSON, ContentTypeHealthJSON) == ContentTypeHealthJSON {
+		p.writeHealthJSON(w, report)
+		return
+	}
+	w.Header().Add("Content-Type", ContentTypeJSON)
+	if report.Status == ProbeStatusOK {
+		w.WriteHeader(ProbeResponseCodeSuccess)
+		w.Write([]byte(ProbeResponseOK))
+		return
+	}
+	reportedErrors := []string{}
+	for _, err := range report.Errors() {
+		reportedErrors = append(reportedErrors, err.Error())
+	}
+	errsAsJSON, marshalError := json.Marshal(reportedErrors)
+	w.WriteHeader(getProbeResponseCode(report))
+	if marshalError != nil {
+		w.Write([]byte(fmt.Sprintf("\"%s\"", marshalError.Error())))
+		return
+	}
+	w.Write(errsAsJSON)
+}
+
+// getCheckName returns the name of the check requested through a subpath of the
+// probe's path, or an empty string if the probe itself was requested
+func (p *HTTPProbe) getCheckName(r *http.Request) string {
+	if len(p.config.Path) == 0 || !strings.HasPrefix(r.URL.Path, p.config.Path) {
+		return ""
+	}
+	return strings.Trim(strings.TrimPrefix(r.URL.Path, p.config.Path), "/")
+}
+
+// getCheck returns the check named :name or nil if it does not exist
+func (p *HTTPProbe) getCheck(name string) *httpProbeCheck {
+	for _, check := range p.getChecks() {
+		if check.Name == name {
+			return check
+		}
+	}
+	return nil
+}
+
+// writeVerbose writes the :report to :w as a human-readable list of checks in
+// the style of the Kubernetes API server's health endpoints
+func (p *HTTPProbe) writeVerbose(w http.ResponseWriter, report HTTPProbeReport) {
+	var output strings.Builder
+	if report.Override != nil {
+		fmt.Fprintf(&output, "[-]%s\n", report.Override.Err())
+	}
+	for _, check := range report.Checks {
+		name := check.Name
+		if len(name) == 0 {
+			name = "unnamed"
+		}
+		if check.Error == nil {
+			fmt.Fprintf(&output, "[+]%s ok\n", name)
+			continue
+		}
+		reason := strings.TrimPrefix(check.Error.Error(), check.Name+": ")
+		if check.NonCritical {
+			fmt.Fprintf(&output, "[!]%s degraded: %s\n", name, reason)
+		} else {
+			fmt.Fprintf(&output, "[-]%s failed: %s\n", name, reason)
+		}
+	}
+	for _, name := range report.Excluded {
+		fmt.Fprintf(&output, "[+]%s excluded: ok\n", name)
+	}
+	fmt.Fprintf(&output, "%s check %s\n", p.config.Type, report.Status)
+	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(getProbeResponseCode(report))
+	w.Write([]byte(output.String()))
+}
+
+// HTTPHealthResponse is a response in the application/health+json format
+type HTTPHealthResponse struct {
+	Status    string                       `json:"status"`
+	Version   string                       `json:"version,omitempty"`
+	ServiceID string                       `json:"serviceId,omitempty"`
+	Output    string                       `json:"output,omitempty"`
+	Checks    map[string][]HTTPHealthCheck `json:"checks,omitempty"`
+}
+
+// HTTPHealthCheck is the outcome of a check in the application/health+json format
+type HTTPHealthCheck struct {
+	Status        string  `json:"status"`
+	ObservedValue float64 `json:"observedValue"`
+	ObservedUnit  string  `json:"observedUnit"`
+	Time          string  `json:"time"`
+	Output        string  `json:"output,omitempty"`
+}
+
+// writeHealthJSON writes the :report to :w in the application/health+json format
+func (p *HTTPProbe) writeHealthJSON(w http.ResponseWriter, report HTTPProbeReport) {
+	response := HTTPHealthResponse{
+		Status:    getHealthStatus(report.Status),
+		Version:   p.config.Version,
+		ServiceID: p.config.ServiceID,
+	}
+	outputs := []string{}
+	if report.Override != nil {
+		outputs = append(outputs, report.Override.Err().Error())
+	}
+	for _, check := range report.Checks {
+		output := ""
+		if check.Error != nil {
+			output = check.Error.Error()
+			outputs = append(outputs, output)
+		}
+		if len(check.Name) == 0 {
+			continue
+		}
+		if response.Checks == nil {
+			response.Checks = map[string][]HTTPHealthCheck{}
+		}
+		status := HealthStatusPass
+		if check.Error != nil && check.NonCritical {
+			status = HealthStatusWarn
+		} else if check.Error != nil {
+			status = HealthStatusFail
+		}
+		key := check.Name + ":responseTime"
+		response.Checks[key] = append(response.Checks[key], HTTPHealthCheck{
+			Status:        status,
+			ObservedValue: float64(check.Duration.Microseconds()) / 1000,
+			ObservedUnit:  "ms",
+			Time:          check.Time.UTC().Format(time.RFC3339Nano),
+			Output:        output,
+		})
+	}
+	response.Output = strings.Join(outputs, "; ")
+	w.Header().Add("Content-Type", ContentTypeHealthJSON)
+	w.WriteHeader(getProbeResponseCode(report))
+	json.NewEncoder(w).Encode(response)
+}
+
+// getProbeResponseCode returns the response status code for the :report
+func getProbeResponseCode(report HTTPProbeReport) int {
+	if report.Status == ProbeStatusFailed {
+		return ProbeResponseCodeError
+	}
+	return ProbeResponseCodeSuccess
+}
+
+// getHealthStatus maps a ProbeStatus* :status to its application/health+json equivalent
+func getHealthStatus(status string) string {
+	switch status {
+	case ProbeStatusDegraded:
+		return HealthStatusWarn
+	case ProbeStatusFailed:
+		return HealthStatusFail
+	}
+	return HealthStatusPass
+}
+
+// httpProbeCheck holds the state of a check needed to apply its thresholds
+type httpProbeCheck struct {
+	types.HTTPProbeCheck
+	mutex     sync.Mutex
+	started   bool
+	failing   bool
+	failures  int
+	successes int
+	lastError error
+}
+
+// run runs the check with the context :ctx and returns its outcome after applying
+// its thresholds
+func (c *httpProbeCheck) run(ctx context.Context) HTTPProbeCheckReport {
+	checkStart := time.Now()
+	err := c.DoContext(ctx)
+	report := HTTPProbeCheckReport{
+		Name:        c.Name,
+		NonCritical: c.NonCritical,
+		Time:        checkStart,
+		Duration:    time.Since(checkStart),
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err != nil {
+		c.failures++
+		c.successes = 0
+		c.lastError = err
+		report.failed = true
+	} else {
+		c.successes++
+		c.failures = 0
+	}
+	switch {
+	case !c.started:
+		c.started = true
+		c.failing = err != nil
+	case !c.failing && c.failures >= threshold(c.FailureThreshold):
+		c.failing = true
+	case c.failing && c.successes >= threshold(c.SuccessThreshold):
+		c.failing = false
+	}
+	report.Status = ProbeStatusOK
+	if c.failing {
+		report.Status = ProbeStatusFailed
+		report.Error = c.lastError
+	}
+	return report
+}
+
+// threshold returns the :configured threshold or the default of 1
+func threshold(configured int) int {
+	if configured < 1 {
+		return 1
+	}
+	return configured
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/usvc/go-server/metrics"
+)
+
+const (
+	ProbeMetricLabelProbe  = "probe"
+	ProbeMetricLabelCheck  = "check"
+	ProbeMetricLabelStatus = "status"
+)
+
+// NewHTTPProbeMetrics registers the probe check metrics with the :registerer and
+// returns them. Metrics already registered by another probe are reused. The optional
+// :constLabels are applied to all of the metrics
+func NewHTTPProbeMetrics(registerer prometheus.Registerer, constLabels ...prometheus.Labels) *HTTPProbeMetrics {
+	labels := []string{ProbeMetricLabelProbe, ProbeMetricLabelCheck}
+	merged := metrics.MergeLabels(constLabels...)
+	return &HTTPProbeMetrics{
+		Status: metrics.Register(registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "probe_check_status",
+			Help:        "Result of the last run of a probe check, 1 if it passed and 0 if it failed",
+			ConstLabels: merged,
+		}, labels)).(*prometheus.GaugeVec),
+		Duration: metrics.Register(registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "probe_check_duration_seconds",
+			Help:        "Duration of probe check runs in seconds",
+			Buckets:     prometheus.DefBuckets,
+			ConstLabels: merged,
+		}, labels)).(*prometheus.HistogramVec),
+		Failures: metrics.Register(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "probe_check_failures_total",
+			Help:        "Number of failed probe check runs",
+			ConstLabels: merged,
+		}, labels)).(*prometheus.CounterVec),
+		ProbeStatus: metrics.Register(registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "probe_status",
+			Help:        "Status of the last run of a probe, 1 for the current status and 0 for the others",
+			ConstLabels: merged,
+		}, []string{ProbeMetricLabelProbe, ProbeMetricLabelStatus})).(*prometheus.GaugeVec),
+		Override: metrics.Register(registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "probe_override",
+			Help:        "1 if a probe has been manually overridden to fail and 0 otherwise",
+			ConstLabels: merged,
+		}, []string{ProbeMetricLabelProbe})).(*prometheus.GaugeVec),
+	}
+}
+
+// HTTPProbeMetrics holds the collectors which probes report their named checks to
+type HTTPProbeMetrics struct {
+	Status      *prometheus.GaugeVec
+	Duration    *prometheus.HistogramVec
+	Failures    *prometheus.CounterVec
+	ProbeStatus *prometheus.GaugeVec
+	Override    *prometheus.GaugeVec
+}
+
+// observe records the outcome :check of a check run by the probe :probe
+func (m *HTTPProbeMetrics) observe(probe string, check HTTPProbeCheckReport) {
+	m.Duration.WithLabelValues(probe, check.Name).Observe(check.Duration.Seconds())
+	if check.failed {
+		m.Failures.WithLabelValues(probe, check.Name).Inc()
+	}
+	if check.Status == ProbeStatusOK {
+		m.Status.WithLabelValues(probe, check.Name).Set(1)
+		return
+	}
+	m.Status.WithLabelValues(probe, check.Name).Set(0)
+}
+
+// observeStatus records the :status of the last run of the probe :probe
+func (m *HTTPProbeMetrics) observeStatus(probe string, status string) {
+	for _, possibleStatus := range []string{ProbeStatusOK, ProbeStatusDegraded, ProbeStatusFailed} {
+		value := float64(0)
+		if possibleStatus == status {
+			value = 1
+		}
+		m.ProbeStatus.WithLabelValues(probe, possibleStatus).Set(value)
+	}
+}
+
+// forget removes the metrics of the check named :check of the probe :probe
+func (m *HTTPProbeMetrics) forget(probe, check string) {
+	m.Status.DeleteLabelValues(probe, check)
+	m.Duration.DeleteLabelValues(probe, check)
+	m.Failures.DeleteLabelValues(probe, check)
+}
+
+// observeOverride records whether the probe :probe is :overridden
+func (m *HTTPProbeMetrics) observeOverride(probe string, overridden bool) {
+	value := float64(0)
+	if overridden {
+		value = 1
+	}
+	m.Override.WithLabelValues(probe).Set(value)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/usvc/go-server/types"
+)
+
+func (s HTTPProbeTests) Test_metrics() {
+	registry := prometheus.NewRegistry()
+	probeMetrics := NewHTTPProbeMetrics(registry)
+	s.Equal(probeMetrics.Status, NewHTTPProbeMetrics(registry).Status, "metrics should be reused")
+
+	passing := true
+	probe := NewHTTPProbe(HTTPProbeConfiguration{
+		Type: ProbeTypeReadiness,
+		Handlers: types.HTTPProbeHandlers{
+			func() error { return nil },
+		},
+		Checks: types.HTTPProbeChecks{
+			{
+				Name: "expected",
+				Handler: func() error {
+					if !passing {
+						return fmt.Errorf("failed")
+					}
+					return nil
+				},
+			},
+		},
+		Metrics: probeMetrics,
+	})
+	s.Nil(probe.Do())
+	s.Equal(float64(1), testutil.ToFloat64(probeMetrics.Status.WithLabelValues(ProbeTypeReadiness, "expected")))
+	s.Equal(float64(0), testutil.ToFloat64(probeMetrics.Failures.WithLabelValues(ProbeTypeReadiness, "expected")))
+
+	passing = false
+	errs := probe.Do()
+	s.Len(errs, 1)
+	s.EqualError(errs[0], "expected: failed")
+	s.Equal(float64(0), testutil.ToFloat64(probeMetrics.Status.WithLabelValues(ProbeTypeReadiness, "expected")))
+	s.Equal(float64(1), testutil.ToFloat64(probeMetrics.Failures.WithLabelValues(ProbeTypeReadiness, "expected")))
+
+	s.Equal(float64(1), testutil.ToFloat64(probeMetrics.ProbeStatus.WithLabelValues(ProbeTypeReadiness, ProbeStatusFailed)))
+	s.Equal(float64(0), testutil.ToFloat64(probeMetrics.ProbeStatus.WithLabelValues(ProbeTypeReadiness, ProbeStatusOK)))
+
+	count, err := testutil.GatherAndCount(registry, "probe_check_duration_seconds")
+	s.Nil(err)
+	s.Equal(1, count, "only named checks should be exported")
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	ProbeOverrideQueryReason = "reason"
+	ProbeOverrideQueryExpiry = "expiry"
+)
+
+// HTTPProbeOverride forces a probe to fail regardless of the outcome of its checks
+type HTTPProbeOverride struct {
+	// Reason explains why the probe has been overridden
+	Reason string `json:"reason"`
+	// ExpiresAt is the time after which the override no longer applies, the
+	// override applies until it is cleared when this is nil
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Err returns the override as the error reported by the probe
+func (o HTTPProbeOverride) Err() error {
+	if o.ExpiresAt != nil {
+		return fmt.Errorf("overridden until %s: %s", o.ExpiresAt.UTC().Format(time.RFC3339), o.Reason)
+	}
+	return fmt.Errorf("overridden: %s", o.Reason)
+}
+
+// SetOverride forces the probe to fail with the :reason until the override is cleared
+// or until :expiry has passed if it is greater than zero
+func (p *HTTPProbe) SetOverride(reason string, expiry time.Duration) {
+	override := &HTTPProbeOverride{Reason: reason}
+	if expiry > 0 {
+		expiresAt := time.Now().Add(expiry)
+		override.ExpiresAt = &expiresAt
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.override = override
+	p.observeOverride(true)
+}
+
+// ClearOverride removes the override of the probe and returns true if one was active
+func (p *HTTPProbe) ClearOverride() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	active := p.override != nil && !p.override.expired()
+	p.override = nil
+	p.observeOverride(false)
+	return active
+}
+
+// GetOverride returns the active override of the probe or nil if there is none
+func (p *HTTPProbe) GetOverride() *HTTPProbeOverride {
+	p.mutex.RLock()
+	override := p.override
+	p.mutex.RUnlock()
+	if override == nil {
+		return nil
+	}
+	if override.expired() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		if p.override == override {
+			p.override = nil
+			p.observeOverride(false)
+		}
+		return nil
+	}
+	return override
+}
+
+// observeOverride records whether the probe is :overridden, the caller must hold the
+// mutex so that the metric reflects the override which is in place
+func (p *HTTPProbe) observeOverride(overridden bool) {
+	if p.config.Metrics != nil {
+		p.config.Metrics.observeOverride(p.config.Type, overridden)
+	}
+}
+
+// expired returns true if the override has an expiry which has passed
+func (o *HTTPProbeOverride) expired() bool {
+	return o.ExpiresAt != nil && time.Now().After(*o.ExpiresAt)
+}
+
+// GetHTTPProbeOverride returns a handler for managing the override of the :probe.
+// GET returns the active override, POST and PUT set an override using the
+// reason and expiry (a duration such as 30m) query or form parameters, and
+// DELETE clears the override
+func GetHTTPProbeOverride(probe *HTTPProbe) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", ContentTypeJSON)
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost, http.MethodPut:
+			reason := r.FormValue(ProbeOverrideQueryReason)
+			if len(reason) == 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(fmt.Sprintf("%q", "a reason is required")))
+				return
+			}
+			var expiry time.Duration
+			if expiryValue := r.FormValue(ProbeOverrideQueryExpiry); len(expiryValue) > 0 {
+				var err error
+				if expiry, err = time.ParseDuration(expiryValue); err != nil || expiry <= 0 {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(fmt.Sprintf("%q", fmt.Sprintf("invalid expiry '%s'", expiryValue))))
+					return
+				}
+			}
+			probe.SetOverride(reason, expiry)
+		case http.MethodDelete:
+			probe.ClearOverride()
+		default:
+			w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		override := probe.GetOverride()
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct {
+			Active   bool               `json:"active"`
+			Override *HTTPProbeOverride `json:"override,omitempty"`
+		}{override != nil, override})
+	}
+}
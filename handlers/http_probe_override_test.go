@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/usvc/go-server/types"
+)
+
+func (s HTTPProbeTests) Test_override() {
+	probeMetrics := NewHTTPProbeMetrics(prometheus.NewRegistry())
+	probe := NewHTTPProbe(HTTPProbeConfiguration{
+		Type: ProbeTypeReadiness,
+		Checks: types.HTTPProbeChecks{
+			{Name: "database", Handler: func() error { return nil }},
+		},
+		Metrics: probeMetrics,
+	})
+	s.Equal(float64(0), testutil.ToFloat64(probeMetrics.Override.WithLabelValues(ProbeTypeReadiness)))
+	s.Nil(probe.GetOverride())
+
+	probe.SetOverride("running migrations", 0)
+	s.Equal(float64(1), testutil.ToFloat64(probeMetrics.Override.WithLabelValues(ProbeTypeReadiness)))
+	report := probe.Run()
+	s.Equal(ProbeStatusFailed, report.Status)
+	s.Equal("running migrations", report.Override.Reason)
+	s.Len(report.Checks, 1, "checks should still run while overridden")
+	s.EqualError(report.Errors()[0], "overridden: running migrations")
+
+	s.True(probe.ClearOverride())
+	s.False(probe.ClearOverride())
+	s.Equal(float64(0), testutil.ToFloat64(probeMetrics.Override.WithLabelValues(ProbeTypeReadiness)))
+	s.Equal(ProbeStatusOK, probe.Run().Status)
+
+	probe.SetOverride("brief maintenance", time.Millisecond)
+	s.Equal(ProbeStatusFailed, probe.Run().Status)
+	<-time.After(5 * time.Millisecond)
+	s.Equal(ProbeStatusOK, probe.Run().Status, "overrides should expire")
+	s.Equal(float64(0), testutil.ToFloat64(probeMetrics.Override.WithLabelValues(ProbeTypeReadiness)))
+
+	probe.SetOverride("brief maintenance", time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	s.False(probe.ClearOverride(), "expired overrides should not be reported as active when cleared")
+	s.Equal(float64(0), testutil.ToFloat64(probeMetrics.Override.WithLabelValues(ProbeTypeReadiness)))
+}
+
+func (s HTTPProbeTests) Test_GetHTTPProbeOverride() {
+	probe := NewHTTPProbe(HTTPProbeConfiguration{Type: ProbeTypeReadiness})
+	handler := http.NewServeMux()
+	handler.Handle("/readyz", probe)
+	handler.HandleFunc("/override", GetHTTPProbeOverride(probe))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	response, err := http.PostForm(server.URL+"/override", url.Values{})
+	s.Nil(err)
+	s.Equal(http.StatusBadRequest, response.StatusCode)
+
+	response, err = http.PostForm(server.URL+"/override", url.Values{"reason": {"migrating"}, "expiry": {"nope"}})
+	s.Nil(err)
+	s.Equal(http.StatusBadRequest, response.StatusCode)
+
+	response, err = http.PostForm(server.URL+"/override", url.Values{"reason": {"migrating"}, "expiry": {"1h"}})
+	s.Nil(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+	var state struct {
+		Active   bool
+		Override HTTPProbeOverride
+	}
+	s.Nil(json.NewDecoder(response.Body).Decode(&state))
+	s.True(state.Active)
+	s.Equal("migrating", state.Override.Reason)
+	s.NotNil(state.Override.ExpiresAt)
+
+	statusCode, body := s.get(server.URL + "/readyz")
+	s.Equal(ProbeResponseCodeError, statusCode)
+	s.Contains(body, "migrating")
+
+	request, err := http.NewRequest(http.MethodDelete, server.URL+"/override", nil)
+	s.Nil(err)
+	response, err = http.DefaultClient.Do(request)
+	s.Nil(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+	statusCode, _ = s.get(server.URL + "/readyz")
+	s.Equal(ProbeResponseCodeSuccess, statusCode)
+
+	request, err = http.NewRequest(http.MethodPatch, server.URL+"/override", nil)
+	s.Nil(err)
+	response, err = http.DefaultClient.Do(request)
+	s.Nil(err)
+	s.Equal(http.StatusMethodNotAllowed, response.StatusCode)
+}
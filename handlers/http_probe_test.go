@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/suite"
+	"github.com/usvc/go-server/types"
+)
+
+type HTTPProbeTests struct {
+	suite.Suite
+}
+
+func TestHTTPProbe(t *testing.T) {
+	suite.Run(t, &HTTPProbeTests{})
+}
+
+func (s HTTPProbeTests) get(url string) (int, string) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	s.Nil(err)
+	response, err := http.DefaultClient.Do(request)
+	s.Nil(err)
+	body, err := ioutil.ReadAll(response.Body)
+	s.Nil(err)
+	return response.StatusCode, string(body)
+}
+
+func (s HTTPProbeTests) Test_startupLatch() {
+	startupReady := false
+	startupRuns := 0
+	startupProbe := NewHTTPProbe(HTTPProbeConfiguration{
+		Type: ProbeTypeStartup,
+		Handlers: types.HTTPProbeHandlers{
+			func() error {
+				startupRuns++
+				if !startupReady {
+					return fmt.Errorf("still warming up")
+				}
+				return nil
+			},
+		},
+		Latch: true,
+	})
+	livenessRuns := 0
+	livenessProbe := NewHTTPProbe(HTTPProbeConfiguration{
+		Type: ProbeTypeLiveness,
+		Handlers: types.HTTPProbeHandlers{
+			func() error {
+				livenessRuns++
+				return fmt.Errorf("not alive")
+			},
+		},
+		Startup: startupProbe,
+	})
+	handler := http.NewServeMux()
+	handler.Handle("/startupz", startupProbe)
+	handler.Handle("/healthz", livenessProbe)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	statusCode, body := s.get(server.URL + "/startupz")
+	s.Equal(ProbeResponseCodeError, statusCode)
+	s.Contains(body, "still warming up")
+	s.False(startupProbe.Succeeded())
+
+	statusCode, body = s.get(server.URL + "/healthz")
+	s.Equal(ProbeResponseCodeSuccess, statusCode, "liveness should pass while starting up")
+	s.Equal(ProbeResponseOK, body)
+	s.Equal(0, livenessRuns)
+	s.Equal(2, startupRuns, "liveness should run the startup checks until they pass")
+
+	startupReady = true
+	statusCode, _ = s.get(server.URL + "/startupz")
+	s.Equal(ProbeResponseCodeSuccess, statusCode)
+	s.True(startupProbe.Succeeded())
+
+	startupReady = false
+	statusCode, _ = s.get(server.URL + "/startupz")
+	s.Equal(ProbeResponseCodeSuccess, statusCode, "startup should remain latched")
+	s.Equal(3, startupRuns)
+
+	statusCode, body = s.get(server.URL + "/healthz")
+	s.Equal(ProbeResponseCodeError, statusCode)
+	s.Contains(body, "not alive")
+	s.Equal(1, livenessRuns)
+}
+
+func (s HTTPProbeTests) Test_startupLatchedByLiveness() {
+	startupProbe := NewHTTPProbe(HTTPProbeConfiguration{
+		Type:  ProbeTypeStartup,
+		Latch: true,
+	})
+	livenessProbe := NewHTTPProbe(HTTPProbeConfiguration{
+		Type: ProbeTypeLiveness,
+		Handlers: types.HTTPProbeHandlers{
+			func() error { return fmt.Errorf("not alive") },
+		},
+		Startup: startupProbe,
+	})
+	report := livenessProbe.Run()
+	s.True(startupProbe.Succeeded(), "liveness should latch the startup probe without it being requested")
+	s.Equal(ProbeStatusFailed, report.Status, "liveness checks should run once the startup probe has latched")
+}
+
+func (s HTTPProbeTests) Test_partialRuns() {
+	registry := prometheus.NewRegistry()
+	probeMetrics := NewHTTPProbeMetrics(registry)
+	cold := fmt.Errorf("still cold")
+	probe := NewHTTPProbe(HTTPProbeConfiguration{
+		Type: ProbeTypeStartup,
+		Path: "/startupz",
+		Checks: types.HTTPProbeChecks{
+			{Name: "warm", Handler: func() error { return nil }},
+			{Name: "cold", Handler: func() error { return cold }},
+		},
+		Latch:   true,
+		Metrics: probeMetrics,
+	})
+	handler := http.NewServeMux()
+	handler.Handle("/startupz", probe)
+	handler.Handle("/startupz/", probe)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	statusCode, _ := s.get(server.URL + "/startupz/warm")
+	s.Equal(ProbeResponseCodeSuccess, statusCode)
+	s.False(probe.Succeeded(), "running a single check should not latch the probe")
+	statusCode, _ = s.get(server.URL + "/startupz?exclude=cold")
+	s.Equal(ProbeResponseCodeSuccess, statusCode)
+	s.False(probe.Succeeded(), "excluding checks should not latch the probe")
+	s.Equal(float64(0), testutil.ToFloat64(probeMetrics.ProbeStatus.WithLabelValues(ProbeTypeStartup, ProbeStatusOK)),
+		"partial runs should not record the status of the probe")
+
+	statusCode, _ = s.get(server.URL + "/startupz")
+	s.Equal(ProbeResponseCodeError, statusCode)
+	s.Equal(float64(1), testutil.ToFloat64(probeMetrics.ProbeStatus.WithLabelValues(ProbeTypeStartup, ProbeStatusFailed)))
+
+	cold = nil
+	statusCode, _ = s.get(server.URL + "/startupz")
+	s.Equal(ProbeResponseCodeSuccess, statusCode)
+	s.True(probe.Succeeded())
+}
+
+func (s HTTPProbeTests) Test_nonCritical() {
+	probe := NewHTTPProbe(HTTPProbeConfiguration{
+		Type: ProbeTypeReadiness,
+		Checks: types.HTTPProbeChecks{
+			{Name: "database", Handler: func() error { return nil }},
+			{Name: "cache", Handler: func() error { return fmt.Errorf("unreachable") }, NonCritical: true},
+		},
+	})
+	report := probe.Run()
+	s.Equal(ProbeStatusDegraded, report.Status)
+	s.Len(report.Checks, 2)
+	s.Equal(ProbeStatusOK, report.Checks[0].Status)
+	s.Equal(ProbeStatusFailed, report.Checks[1].Status)
+	s.True(report.Checks[1].NonCritical)
+
+	server := httptest.NewServer(probe)
+	defer server.Close()
+	statusCode, body := s.get(server.URL)
+	s.Equal(ProbeResponseCodeSuccess, statusCode, "degraded probes should still pass")
+	s.Equal(`["cache: unreachable"]`, body)
+}
+
+func (s HTTPProbeTests) Test_thresholds() {
+	results := []error{nil, fmt.Errorf("1"), fmt.Errorf("2"), fmt.Errorf("3"), nil, nil}
+	run := 0
+	probe := NewHTTPProbe(HTTPProbeConfiguration{
+		Type: ProbeTypeReadiness,
+		Checks: types.HTTPProbeChecks{
+			{
+				Name: "flapping",
+				Handler: func() error {
+					err := results[run]
+					run++
+					return err
+				},
+				FailureThreshold: 3,
+				SuccessThreshold: 2,
+			},
+		},
+	})
+	expectedStatuses := []string{
+		ProbeStatusOK,
+		ProbeStatusOK,
+		ProbeStatusOK,
+		ProbeStatusFailed,
+		ProbeStatusFailed,
+		ProbeStatusOK,
+	}
+	for i, expectedStatus := range expectedStatuses {
+		report := probe.Run()
+		s.Equal(expectedStatus, report.Status, "run %v", i)
+	}
+}
+
+func (s HTTPProbeTests) Test_healthJSON() {
+	probe := NewHTTPProbe(HTTPProbeConfiguration{
+		Type: ProbeTypeReadiness,
+		Handlers: types.HTTPProbeHandlers{
+			func() error { return nil },
+		},
+		Checks: types.HTTPProbeChecks{
+			{Name: "database", Handler: func() error { return nil }},
+			{Name: "cache", Handler: func() error { return fmt.Errorf("unreachable") }, NonCritical: true},
+		},
+		Version:   "1.2.3",
+		ServiceID: "expected-service",
+	})
+	server := httptest.NewServer(probe)
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	s.Nil(err)
+	request.Header.Set("Accept", ContentTypeHealthJSON)
+	response, err := http.DefaultClient.Do(request)
+	s.Nil(err)
+	s.Equal(ProbeResponseCodeSuccess, response.StatusCode)
+	s.Equal(ContentTypeHealthJSON, response.Header.Get("Content-Type"))
+	var health HTTPHealthResponse
+	s.Nil(json.NewDecoder(response.Body).Decode(&health))
+	s.Equal(HealthStatusWarn, health.Status)
+	s.Equal("1.2.3", health.Version)
+	s.Equal("expected-service", health.ServiceID)
+	s.Equal("cache: unreachable", health.Output)
+	s.Len(health.Checks, 2)
+	s.Equal(HealthStatusPass, health.Checks["database:responseTime"][0].Status)
+	s.Equal(HealthStatusWarn, health.Checks["cache:responseTime"][0].Status)
+	s.Equal("cache: unreachable", health.Checks["cache:responseTime"][0].Output)
+	s.Equal("ms", health.Checks["cache:responseTime"][0].ObservedUnit)
+
+	statusCode, body := s.get(server.URL)
+	s.Equal(ProbeResponseCodeSuccess, statusCode, "plain json should remain the default")
+	s.Equal(`["cache: unreachable"]`, body)
+}
+
+func (s HTTPProbeTests) Test_subpathsAndQueries() {
+	probe := NewHTTPProbe(HTTPProbeConfiguration{
+		Type: ProbeTypeReadiness,
+		Path: "/readyz",
+		Checks: types.HTTPProbeChecks{
+			{Name: "database", Handler: func() error { return nil }},
+			{Name: "etcd", Handler: func() error { return fmt.Errorf("unreachable") }},
+		},
+	})
+	handler := http.NewServeMux()
+	handler.Handle("/readyz", probe)
+	handler.Handle("/readyz/", probe)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	statusCode, body := s.get(server.URL + "/readyz")
+	s.Equal(ProbeResponseCodeError, statusCode)
+	s.Equal(`["etcd: unreachable"]`, body)
+
+	statusCode, body = s.get(server.URL + "/readyz/database")
+	s.Equal(ProbeResponseCodeSuccess, statusCode)
+	s.Equal(ProbeResponseOK, body)
+
+	statusCode, body = s.get(server.URL + "/readyz/etcd")
+	s.Equal(ProbeResponseCodeError, statusCode)
+	s.Equal(`["etcd: unreachable"]`, body)
+
+	statusCode, body = s.get(server.URL + "/readyz/missing")
+	s.Equal(http.StatusNotFound, statusCode)
+	s.Contains(body, "check 'missing' does not exist")
+
+	statusCode, body = s.get(server.URL + "/readyz?exclude=etcd")
+	s.Equal(ProbeResponseCodeSuccess, statusCode)
+	s.Equal(ProbeResponseOK, body)
+
+	statusCode, body = s.get(server.URL + "/readyz?verbose")
+	s.Equal(ProbeResponseCodeError, statusCode)
+	s.Equal("[+]database ok\n[-]etcd failed: unreachable\nreadiness check failed\n", body)
+
+	statusCode, body = s.get(server.URL + "/readyz?verbose&exclude=etcd")
+	s.Equal(ProbeResponseCodeSuccess, statusCode)
+	s.Equal("[+]database ok\n[+]etcd excluded: ok\nreadiness check ok\n", body)
+}
+
+func (s HTTPProbeTests) Test_runtimeChecks() {
+	registry := prometheus.NewRegistry()
+	probe := NewHTTPProbe(HTTPProbeConfiguration{
+		Type:    ProbeTypeReadiness,
+		Metrics: NewHTTPProbeMetrics(registry),
+	})
+	s.Nil(probe.Run().Checks)
+
+	s.NotNil(probe.AddCheck(types.HTTPProbeCheck{Handler: func() error { return nil }}), "unnamed checks should be rejected")
+	s.Nil(probe.AddCheck(types.HTTPProbeCheck{Name: "lazy", Handler: func() error { return fmt.Errorf("not connected") }}))
+	s.NotNil(probe.AddCheck(types.HTTPProbeCheck{Name: "lazy", Handler: func() error { return nil }}), "duplicate checks should be rejected")
+	report := probe.Run()
+	s.Equal(ProbeStatusFailed, report.Status)
+	s.Len(report.Checks, 1)
+	count, err := testutil.GatherAndCount(registry, "probe_check_status")
+	s.Nil(err)
+	s.Equal(1, count)
+
+	s.True(probe.RemoveCheck("lazy"))
+	s.False(probe.RemoveCheck("lazy"))
+	report = probe.Run()
+	s.Equal(ProbeStatusOK, report.Status)
+	s.Len(report.Checks, 0)
+	count, err = testutil.GatherAndCount(registry, "probe_check_status")
+	s.Nil(err)
+	s.Equal(0, count, "metrics of removed checks should be removed")
+
+	var tasks sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		tasks.Add(2)
+		name := fmt.Sprintf("concurrent-%v", i)
+		go func() {
+			defer tasks.Done()
+			s.Nil(probe.AddCheck(types.HTTPProbeCheck{Name: name, Handler: func() error { return nil }}))
+		}()
+		go func() {
+			defer tasks.Done()
+			probe.Run()
+		}()
+	}
+	tasks.Wait()
+	s.Len(probe.Run().Checks, 10)
+}
+
+func (s HTTPProbeTests) Test_requestContext() {
+	type contextKey string
+	received := make(chan context.Context, 1)
+	probe := NewHTTPProbe(HTTPProbeConfiguration{
+		Type: ProbeTypeReadiness,
+		Checks: types.HTTPProbeChecks{
+			{
+				Name:    "context-aware",
+				Timeout: time.Second,
+				ContextHandler: func(ctx context.Context) error {
+					received <- ctx
+					<-ctx.Done()
+					return ctx.Err()
+				},
+			},
+		},
+	})
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), contextKey("key"), "value"))
+	request := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	recorder := httptest.NewRecorder()
+	go func() {
+		<-time.After(5 * time.Millisecond)
+		cancel()
+	}()
+	probe.ServeHTTP(recorder, request)
+	s.Equal("value", (<-received).Value(contextKey("key")), "checks should receive the request's context")
+	s.Equal(ProbeResponseCodeError, recorder.Code)
+	s.Contains(recorder.Body.String(), "context-aware: aborted: context canceled")
+}
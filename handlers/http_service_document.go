@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	// ServiceDocumentPath is the well-known path of the service discovery document
+	// ref: https://tools.ietf.org/html/rfc8615
+	ServiceDocumentPath = "/.well-known/service"
+
+	ServiceEndpointLiveness          = ProbeTypeLiveness
+	ServiceEndpointMetrics           = "metrics"
+	ServiceEndpointReadiness         = ProbeTypeReadiness
+	ServiceEndpointReadinessOverride = "readinessOverride"
+	ServiceEndpointStartup           = ProbeTypeStartup
+	ServiceEndpointVersion           = "version"
+)
+
+// ServiceDocument describes what a service exposes so that consumers such as API
+// gateways can configure themselves
+type ServiceDocument struct {
+	// Name is the name of the service
+	Name string `json:"name"`
+	// Version is the version of the service
+	Version string `json:"version"`
+	// Endpoints are the enabled built-in endpoints keyed by one of the
+	// ServiceEndpoint* constants
+	Endpoints map[string]ServiceDocumentEndpoint `json:"endpoints"`
+	// CORS is the cross-origin resource sharing policy, this is nil if CORS is disabled
+	CORS *ServiceDocumentCORS `json:"cors,omitempty"`
+	// Routes are the application routes registered through the server
+	Routes []ServiceDocumentRoute `json:"routes"`
+}
+
+type ServiceDocumentEndpoint struct {
+	Path string `json:"path"`
+	// Protected is true if requests to the endpoint require a password
+	Protected bool `json:"protected"`
+}
+
+type ServiceDocumentCORS struct {
+	AllowCredentials bool     `json:"allowCredentials"`
+	AllowHeaders     []string `json:"allowHeaders"`
+	AllowMethods     []string `json:"allowMethods"`
+	AllowOrigins     []string `json:"allowOrigins"`
+	// AllowOriginPatterns are regular expressions matching allowed origins
+	AllowOriginPatterns []string `json:"allowOriginPatterns,omitempty"`
+	AllowPrivateNetwork bool     `json:"allowPrivateNetwork"`
+	ExposeHeaders       []string `json:"exposeHeaders"`
+	// MaxAge is the number of seconds for which preflight responses can be cached
+	MaxAge int `json:"maxAge"`
+	// ReportOnly is true if requests rejected by the policy are allowed
+	ReportOnly bool `json:"reportOnly"`
+	// Routes are policies which apply instead of this one to the requests matching
+	// them, the first matching route is used
+	Routes []ServiceDocumentCORSRoute `json:"routes,omitempty"`
+	// ExcludePaths are paths which, along with their subpaths, are not subject to CORS
+	ExcludePaths []string `json:"excludePaths,omitempty"`
+}
+
+type ServiceDocumentCORSRoute struct {
+	PathPrefix string               `json:"pathPrefix,omitempty"`
+	Route      string               `json:"route,omitempty"`
+	Policy     *ServiceDocumentCORS `json:"policy"`
+}
+
+type ServiceDocumentRoute struct {
+	Pattern string `json:"pattern"`
+}
+
+// GetHTTPServiceDocument returns a handler which responds with the JSON encoding of the
+// document returned by :document, which is called on every request so that routes
+// registered after the server was created are included
+func GetHTTPServiceDocument(document func() ServiceDocument) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := json.Marshal(document())
+		if err != nil {
+			w.Header().Set("Content-Type", ContentTypeText)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type HTTPServiceDocumentTests struct {
+	suite.Suite
+}
+
+func TestHTTPServiceDocument(t *testing.T) {
+	suite.Run(t, &HTTPServiceDocumentTests{})
+}
+
+func (s HTTPServiceDocumentTests) Test_GetHTTPServiceDocument() {
+	routes := []ServiceDocumentRoute{}
+	handler := GetHTTPServiceDocument(func() ServiceDocument {
+		return ServiceDocument{
+			Name:    "expected-service",
+			Version: "1.2.3",
+			Endpoints: map[string]ServiceDocumentEndpoint{
+				ServiceEndpointMetrics: {Path: "/metrics", Protected: true},
+			},
+			Routes: routes,
+		}
+	})
+	get := func() map[string]interface{} {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodGet, ServiceDocumentPath, nil))
+		s.Equal(http.StatusOK, recorder.Code)
+		s.Equal(ContentTypeJSON, recorder.Header().Get("Content-Type"))
+		var document map[string]interface{}
+		s.Nil(json.Unmarshal(recorder.Body.Bytes(), &document))
+		return document
+	}
+
+	document := get()
+	s.Equal("expected-service", document["name"])
+	s.Equal("1.2.3", document["version"])
+	s.Equal(map[string]interface{}{
+		"metrics": map[string]interface{}{"path": "/metrics", "protected": true},
+	}, document["endpoints"])
+	s.NotContains(document, "cors")
+	s.Equal([]interface{}{}, document["routes"])
+
+	routes = append(routes, ServiceDocumentRoute{Pattern: "/api/"})
+	s.Equal([]interface{}{map[string]interface{}{"pattern": "/api/"}}, get()["routes"],
+		"the document should be built on every request")
+}
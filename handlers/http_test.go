@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -127,6 +128,36 @@ func (s HandlersTests) Test_GetHTTPMetricsProbe() {
 	s.Contains(string(body), fmt.Sprintf("%s %v", expectedMetricName, expectedMetricValue))
 }
 
+func (s HandlersTests) Test_GetHTTPMetricsOpenMetrics() {
+	customRegistry := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "testing_get_http_metrics_open_metrics_total",
+		Help: "no need for this",
+	})
+	counter.(prometheus.ExemplarAdder).AddWithExemplar(1, prometheus.Labels{"request_id": "expected-id"})
+	customRegistry.Register(counter)
+	server := httptest.NewServer(GetHTTPMetrics(customRegistry))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	s.Nil(err)
+	request.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+	response, err := http.DefaultClient.Do(request)
+	s.Nil(err)
+	body, err := ioutil.ReadAll(response.Body)
+	s.Nil(err)
+	s.Contains(response.Header.Get("Content-Type"), "application/openmetrics-text")
+	s.Contains(string(body), `testing_get_http_metrics_open_metrics_total 1.0 # {request_id="expected-id"} 1.0`)
+	s.True(strings.HasSuffix(string(body), "# EOF\n"))
+
+	response, err = http.Get(server.URL)
+	s.Nil(err)
+	body, err = ioutil.ReadAll(response.Body)
+	s.Nil(err)
+	s.Contains(response.Header.Get("Content-Type"), "text/plain")
+	s.NotContains(string(body), "expected-id", "exemplars should only be served in the openmetrics format")
+}
+
 func (s HandlersTests) Test_GetHTTPReadinessProbe() {
 	done := []bool{}
 	readinessProbeHandlers := types.HTTPProbeHandlers{
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/usvc/go-server/build"
+)
+
+const ContentTypeText = "text/plain"
+
+type HTTPVersionConfiguration struct {
+	// Value when defined overrides the version resolved from the build information
+	Value string
+	// Info is the build information to report, defaults to build.GetInfo()
+	Info *build.Info
+	// Dependencies when set includes the versions of the modules the binary was
+	// built with in JSON responses
+	Dependencies bool
+}
+
+// NewHTTPVersion returns a handler which responds with the version as plain text by
+// default, or with the build information defined in :config as JSON if the request
+// prefers application/json
+func NewHTTPVersion(config HTTPVersionConfiguration) http.HandlerFunc {
+	var info build.Info
+	if config.Info != nil {
+		info = *config.Info
+	} else {
+		info = build.GetInfo()
+	}
+	if len(config.Value) > 0 {
+		info.Version = config.Value
+	}
+	if !config.Dependencies {
+		info.Dependencies = nil
+	}
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		infoJSON = []byte(`{}`)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		switch negotiateContentType(r, ContentTypeText, ContentTypeJSON) {
+		case ContentTypeJSON:
+			w.Header().Set("Content-Type", ContentTypeJSON)
+			w.WriteHeader(http.StatusOK)
+			w.Write(infoJSON)
+		default:
+			w.Header().Set("Content-Type", ContentTypeText)
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(info.Version))
+		}
+	}
+}
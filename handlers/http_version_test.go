@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/usvc/go-server/build"
+)
+
+type HTTPVersionTests struct {
+	suite.Suite
+}
+
+func TestHTTPVersion(t *testing.T) {
+	suite.Run(t, &HTTPVersionTests{})
+}
+
+func (s HTTPVersionTests) serve(handler http.HandlerFunc, accept string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/version", nil)
+	if len(accept) > 0 {
+		request.Header.Set("Accept", accept)
+	}
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+	return recorder
+}
+
+func (s HTTPVersionTests) Test_negotiation() {
+	info := build.Info{
+		Version:      "0.0.1",
+		Commit:       "abcdef",
+		Dirty:        true,
+		BuildTime:    "2020-01-02T03:04:05Z",
+		GoVersion:    "go1.15",
+		Dependencies: []build.Dependency{{Path: "example.com/dependency", Version: "v1.0.0"}},
+	}
+	handler := NewHTTPVersion(HTTPVersionConfiguration{Value: "1.2.3", Info: &info})
+
+	for _, accept := range []string{"", "*/*", "text/plain"} {
+		response := s.serve(handler, accept)
+		s.Equal(http.StatusOK, response.Code)
+		s.Equal(ContentTypeText, response.Header().Get("Content-Type"), "accept: %q", accept)
+		s.Equal("1.2.3", response.Body.String())
+	}
+
+	response := s.serve(handler, "application/json")
+	s.Equal(ContentTypeJSON, response.Header().Get("Content-Type"))
+	s.Equal("Accept", response.Header().Get("Vary"))
+	var body map[string]interface{}
+	s.Nil(json.Unmarshal(response.Body.Bytes(), &body))
+	s.Equal(map[string]interface{}{
+		"version":   "1.2.3",
+		"commit":    "abcdef",
+		"dirty":     true,
+		"buildTime": "2020-01-02T03:04:05Z",
+		"goVersion": "go1.15",
+	}, body, "dependencies should be excluded unless enabled")
+}
+
+func (s HTTPVersionTests) Test_dependencies() {
+	info := build.Info{
+		Version:      "1.2.3",
+		Dependencies: []build.Dependency{{Path: "example.com/dependency", Version: "v1.0.0", Replace: "../dependency"}},
+	}
+	handler := NewHTTPVersion(HTTPVersionConfiguration{Info: &info, Dependencies: true})
+	response := s.serve(handler, "application/json")
+	var body build.Info
+	s.Nil(json.Unmarshal(response.Body.Bytes(), &body))
+	s.Equal("1.2.3", body.Version)
+	s.Equal(info.Dependencies, body.Dependencies)
+}
+
+func (s HTTPVersionTests) Test_defaultInfo() {
+	response := s.serve(NewHTTPVersion(HTTPVersionConfiguration{}), "application/json")
+	var body build.Info
+	s.Nil(json.Unmarshal(response.Body.Bytes(), &body))
+	s.Equal(build.GetInfo().Version, body.Version)
+	s.NotEmpty(body.GoVersion)
+}
@@ -6,12 +6,16 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/usvc/go-server/handlers"
+	"github.com/usvc/go-server/metrics"
 	"github.com/usvc/go-server/middleware"
+	"github.com/usvc/go-server/types"
 )
 
 type FuncHandler interface {
@@ -25,24 +29,126 @@ func NewHTTP(opts HTTPOptions, mux FuncHandler) *HTTP {
 	addr := opts.Addr.String()
 	errorLogger := log.New(loggerFromExternalLogger{Print: opts.Loggers.ServerEvent}, "", 0)
 
+	registerer := opts.Metrics.GetRegisterer()
+	constLabels := opts.Metrics.getConstLabels(opts.Service)
+	sink := opts.Metrics.Sink
+
+	var otlp *metrics.OTLP
+	if !opts.Disable.OTLPMetrics {
+		var err error
+		if otlp, err = metrics.NewOTLP(getOTLPConfiguration(opts)); err != nil {
+			errorLogger.Printf("otlp metrics export is DISABLED because it could not be configured: %s", err)
+		} else {
+			errorLogger.Print("otlp metrics export is ENABLED")
+			if sink == nil {
+				sink = otlp
+			} else {
+				sink = metrics.Sinks{sink, otlp}
+			}
+		}
+	}
+
+	var lifecycleMetrics *httpMetrics
+	if !opts.Disable.Metrics {
+		lifecycleMetrics = newHTTPMetrics(registerer, constLabels, opts.Version.Value, sink)
+	}
+
+	endpoints := map[string]handlers.ServiceDocumentEndpoint{}
+
+	var probeMetrics *handlers.HTTPProbeMetrics
+	if !opts.Disable.StartupProbe || !opts.Disable.LivenessProbe || !opts.Disable.ReadinessProbe {
+		probeMetrics = handlers.NewHTTPProbeMetrics(registerer, constLabels)
+	}
+
+	var startupProbe *handlers.HTTPProbe
+	if !opts.Disable.StartupProbe {
+		errorLogger.Print("startup probe is ENABLED")
+		startupProbe = handlers.NewHTTPProbe(handlers.HTTPProbeConfiguration{
+			Type:      handlers.ProbeTypeStartup,
+			Path:      opts.StartupProbe.Path,
+			Handlers:  opts.StartupProbe.Handlers,
+			Checks:    opts.StartupProbe.Checks,
+			Metrics:   probeMetrics,
+			Version:   opts.Version.Value,
+			ServiceID: opts.Service.Name,
+			Latch:     true,
+		})
+		endpoints[handlers.ServiceEndpointStartup] = registerProbe(mux, opts, opts.StartupProbe, startupProbe)
+	}
+
+	var livenessProbe *handlers.HTTPProbe
 	if !opts.Disable.LivenessProbe {
 		errorLogger.Print("liveness probe is ENABLED")
-		mux.HandleFunc(opts.LivenessProbe.Path, handlers.GetHTTPReadinessProbe(opts.ReadinessProbe.Handlers))
+		livenessProbe = handlers.NewHTTPProbe(handlers.HTTPProbeConfiguration{
+			Type:      handlers.ProbeTypeLiveness,
+			Path:      opts.LivenessProbe.Path,
+			Handlers:  opts.LivenessProbe.Handlers,
+			Checks:    opts.LivenessProbe.Checks,
+			Metrics:   probeMetrics,
+			Version:   opts.Version.Value,
+			ServiceID: opts.Service.Name,
+			Startup:   startupProbe,
+		})
+		endpoints[handlers.ServiceEndpointLiveness] = registerProbe(mux, opts, opts.LivenessProbe, livenessProbe)
 	}
 
+	var readinessProbe *handlers.HTTPProbe
 	if !opts.Disable.ReadinessProbe {
 		errorLogger.Print("readiness probe is ENABLED")
-		mux.HandleFunc(opts.ReadinessProbe.Path, handlers.GetHTTPLivenessProbe(opts.ReadinessProbe.Handlers))
+		readinessProbe = handlers.NewHTTPProbe(handlers.HTTPProbeConfiguration{
+			Type:      handlers.ProbeTypeReadiness,
+			Path:      opts.ReadinessProbe.Path,
+			Handlers:  opts.ReadinessProbe.Handlers,
+			Checks:    opts.ReadinessProbe.Checks,
+			Metrics:   probeMetrics,
+			Version:   opts.Version.Value,
+			ServiceID: opts.Service.Name,
+		})
+		endpoints[handlers.ServiceEndpointReadiness] = registerProbe(mux, opts, opts.ReadinessProbe, readinessProbe)
+
+		if !opts.Disable.ReadinessOverride {
+			password, err := opts.ReadinessOverride.GetPassword()
+			if err == nil && len(password) == 0 {
+				password, err = opts.ReadinessProbe.GetPassword()
+			}
+			if err == nil && len(password) == 0 {
+				errorLogger.Print("readiness override is DISABLED because no password has been set")
+			} else {
+				errorLogger.Print("readiness override is ENABLED")
+				endpoints[handlers.ServiceEndpointReadinessOverride] = newServiceDocumentEndpoint(opts.ReadinessOverride.Path, password, err)
+				mux.HandleFunc(opts.ReadinessOverride.Path, withPassword(opts, opts.ReadinessOverride.Path, password, err, handlers.GetHTTPProbeOverride(readinessProbe)))
+			}
+		}
 	}
 
 	if !opts.Disable.Metrics {
 		errorLogger.Print("metrics is ENABLED")
-		mux.HandleFunc(opts.Metrics.Path, handlers.GetHTTPMetrics())
+		password, err := opts.Metrics.GetPassword()
+		endpoints[handlers.ServiceEndpointMetrics] = newServiceDocumentEndpoint(opts.Metrics.Path, password, err)
+		metricsHandler := handlers.GetHTTPMetrics(opts.Metrics.GetGatherer())
+		if opts.Metrics.Registerer == nil && opts.Metrics.Gatherer == nil {
+			// the default registry is served with the metrics of the handler itself
+			metricsHandler = handlers.GetHTTPMetrics()
+		}
+		mux.HandleFunc(opts.Metrics.Path, withPassword(opts, opts.Metrics.Path, password, err, metricsHandler))
 	}
 
 	if !opts.Disable.Version {
 		errorLogger.Print("version is ENABLED")
-		mux.HandleFunc(opts.Version.Path, handlers.GetHTTPVersion(opts.Version.Value))
+		password, err := opts.Version.GetPassword()
+		endpoints[handlers.ServiceEndpointVersion] = newServiceDocumentEndpoint(opts.Version.Path, password, err)
+		mux.HandleFunc(opts.Version.Path, withPassword(opts, opts.Version.Path, password, err, handlers.NewHTTPVersion(handlers.HTTPVersionConfiguration{
+			Value:        opts.Version.Value,
+			Dependencies: opts.Version.Dependencies,
+		})))
+	}
+
+	cors := getCORSConfiguration(opts, endpoints)
+	routes := &httpRoutes{}
+	if !opts.Disable.ServiceDocument {
+		errorLogger.Print("service document is ENABLED")
+		password, err := opts.ServiceDocument.GetPassword()
+		mux.HandleFunc(opts.ServiceDocument.Path, withPassword(opts, opts.ServiceDocument.Path, password, err, handlers.GetHTTPServiceDocument(getServiceDocument(opts, cors, endpoints, routes))))
 	}
 
 	handler := http.Handler(mux)
@@ -53,12 +159,42 @@ func NewHTTP(opts HTTPOptions, mux FuncHandler) *HTTP {
 	}
 	if !opts.Disable.CORS {
 		errorLogger.Print("cross-origin resource sharing is ENABLED")
-		middlewares = append(middlewares, middleware.NewCORS(opts.CORS))
+		if cors.Log == nil {
+			cors.Log = opts.Loggers.Request
+		}
+		if cors.Registerer == nil {
+			cors.Registerer = registerer
+		}
+		if cors.Sink == nil {
+			cors.Sink = sink
+		}
+		cors.ConstLabels = metrics.MergeLabels(constLabels, cors.ConstLabels)
+		middlewares = append(middlewares, middleware.NewCORS(cors))
 	}
 	if !opts.Disable.RequestLogger {
 		errorLogger.Print("request logging is ENABLED")
 		middlewares = append(middlewares, middleware.NewRequestLogger(middleware.RequestLoggerConfiguration{Log: opts.Loggers.Request}))
 	}
+	if !opts.Disable.RequestMetrics {
+		errorLogger.Print("request metrics is ENABLED")
+		requestMetrics := opts.RequestMetrics
+		if requestMetrics.Registerer == nil {
+			requestMetrics.Registerer = registerer
+		}
+		if requestMetrics.Sink == nil {
+			requestMetrics.Sink = sink
+		}
+		requestMetrics.ConstLabels = metrics.MergeLabels(constLabels, requestMetrics.ConstLabels)
+		middlewares = append(middlewares, middleware.NewRequestMetrics(requestMetrics))
+	}
+	if !opts.Disable.RouteResolver {
+		errorLogger.Print("route resolution is ENABLED")
+		routeResolver := opts.RouteResolver
+		if matcher, ok := mux.(middleware.RouteMatcher); ok && routeResolver.Mux == nil {
+			routeResolver.Mux = matcher
+		}
+		middlewares = append(middlewares, middleware.NewRouteResolver(routeResolver))
+	}
 	if !opts.Disable.RequestIdentifier {
 		errorLogger.Print("request identification is ENABLED")
 		middlewares = append(middlewares, middleware.NewRequestIdentifier(middleware.RequestIdentifierConfiguration{}))
@@ -79,10 +215,88 @@ func NewHTTP(opts HTTPOptions, mux FuncHandler) *HTTP {
 			ReadHeaderTimeout: opts.Timeouts.ReadHeader,
 			WriteTimeout:      opts.Timeouts.Write,
 		},
+		mux:              mux,
+		routes:           routes,
+		livenessProbe:    livenessProbe,
+		readinessProbe:   readinessProbe,
+		otlp:             otlp,
+		lifecycleMetrics: lifecycleMetrics,
 	}
 	return &s
 }
 
+// getCORSConfiguration returns the CORS configuration from :opts with the paths of the
+// built-in :endpoints and of the service document excluded unless that is disabled
+func getCORSConfiguration(opts HTTPOptions, endpoints map[string]handlers.ServiceDocumentEndpoint) middleware.CORSConfiguration {
+	config := opts.CORS
+	if opts.Disable.CORSOperationalExclusion {
+		return config
+	}
+	excludePaths := []string{}
+	for _, endpoint := range endpoints {
+		excludePaths = append(excludePaths, endpoint.Path)
+	}
+	if !opts.Disable.ServiceDocument {
+		excludePaths = append(excludePaths, opts.ServiceDocument.Path)
+	}
+	sort.Strings(excludePaths)
+	config.ExcludePaths = append(excludePaths, config.ExcludePaths...)
+	return config
+}
+
+// getOTLPConfiguration returns the configuration of the OTLP exporter with the resource
+// attributes of the service and the buckets of the request size metrics filled in
+func getOTLPConfiguration(opts HTTPOptions) metrics.OTLPConfiguration {
+	config := opts.Metrics.OTLP
+	resource := map[string]string{
+		"service.name":        opts.Service.Name,
+		"service.version":     opts.Version.Value,
+		"service.instance.id": opts.Service.Instance,
+	}
+	for key, value := range config.Resource {
+		resource[key] = value
+	}
+	config.Resource = resource
+	buckets := map[string][]float64{
+		middleware.RequestMetricsSinkRequestSize:  opts.RequestMetrics.SizeBuckets,
+		middleware.RequestMetricsSinkResponseSize: opts.RequestMetrics.SizeBuckets,
+	}
+	for name, bounds := range config.Buckets {
+		buckets[name] = bounds
+	}
+	config.Buckets = buckets
+	if config.Log == nil {
+		config.Log = opts.Loggers.ServerEvent
+	}
+	return config
+}
+
+// withPassword protects the :handler registered at :path with the :password if one has
+// been set. If loading the password resulted in an error :loadErr, all requests are rejected
+func withPassword(opts HTTPOptions, path, password string, loadErr error, handler http.HandlerFunc) http.HandlerFunc {
+	if loadErr != nil {
+		opts.Loggers.ServerEvent(fmt.Sprintf("failed to load password for '%s', rejecting all requests: %s", path, loadErr))
+	} else if len(password) == 0 {
+		return handler
+	}
+	protect := middleware.NewPassword(middleware.PasswordConfiguration{
+		Password: password,
+		Log:      opts.Loggers.ServerEvent,
+	})
+	return protect(handler).ServeHTTP
+}
+
+// registerProbe registers the :probe handler at the path defined in :probeOpts and at
+// the subpaths used to run its checks individually, returning its description for the
+// service document
+func registerProbe(mux FuncHandler, opts HTTPOptions, probeOpts HTTPProbe, probe *handlers.HTTPProbe) handlers.ServiceDocumentEndpoint {
+	password, err := probeOpts.GetPassword()
+	handler := withPassword(opts, probeOpts.Path, password, err, probe.ServeHTTP)
+	mux.HandleFunc(probeOpts.Path, handler)
+	mux.HandleFunc(strings.TrimSuffix(probeOpts.Path, "/")+"/", handler)
+	return newServiceDocumentEndpoint(probeOpts.Path, password, err)
+}
+
 // HTTP defines a class for a HTTP-based server
 type HTTP struct {
 	// Options provides the configuraton for the HTTP server
@@ -90,12 +304,97 @@ type HTTP struct {
 	// Server points to the raw instance of a http.Server used internally
 	Server *http.Server
 
+	// mux is the handler of the custom routes provided to NewHTTP
+	mux FuncHandler
+	// routes are the custom routes registered through the server
+	routes *httpRoutes
 	// events is a channel for internal communication, avoid subscribing to this since
 	// that may cause some events to be missed by internal event handlers
 	events chan error
 	// signals is a channel to pass system interrupts from process to internal event handlers.
 	// to disable this, set the configuration in Options.Disable.SignalHandling
 	signals chan os.Signal
+	// livenessProbe is the handler of the liveness probe, this is nil if the liveness
+	// probe is disabled
+	livenessProbe *handlers.HTTPProbe
+	// readinessProbe is the handler of the readiness probe, this is nil if the readiness
+	// probe is disabled
+	readinessProbe *handlers.HTTPProbe
+	// otlp exports metrics to an OpenTelemetry collector, this is nil if OTLP metrics
+	// export is disabled
+	otlp *metrics.OTLP
+	// lifecycleMetrics records the build information and lifecycle of the server, this
+	// is nil if metrics are disabled
+	lifecycleMetrics *httpMetrics
+	// flushOnce ensures metrics are only flushed once however the server is stopped
+	flushOnce sync.Once
+}
+
+// Handle registers the :handler for the :pattern on the custom routes handler and
+// lists the route in the service document
+func (h *HTTP) Handle(pattern string, handler http.Handler) {
+	h.HandleFunc(pattern, handler.ServeHTTP)
+}
+
+// HandleFunc registers the :handler for the :pattern on the custom routes handler and
+// lists the route in the service document
+func (h *HTTP) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	h.mux.HandleFunc(pattern, handler)
+	h.routes.add(pattern)
+}
+
+// AddLivenessCheck adds the named :check to the liveness probe while the server is running
+func (h *HTTP) AddLivenessCheck(check types.HTTPProbeCheck) error {
+	if h.livenessProbe == nil {
+		return fmt.Errorf("liveness probe is disabled")
+	}
+	return h.livenessProbe.AddCheck(check)
+}
+
+// RemoveLivenessCheck removes the check named :name from the liveness probe and
+// returns true if it existed
+func (h *HTTP) RemoveLivenessCheck(name string) bool {
+	if h.livenessProbe == nil {
+		return false
+	}
+	return h.livenessProbe.RemoveCheck(name)
+}
+
+// AddReadinessCheck adds the named :check to the readiness probe while the server is running
+func (h *HTTP) AddReadinessCheck(check types.HTTPProbeCheck) error {
+	if h.readinessProbe == nil {
+		return fmt.Errorf("readiness probe is disabled")
+	}
+	return h.readinessProbe.AddCheck(check)
+}
+
+// SetReadinessOverride forces the readiness probe to fail with the :reason, taking the
+// instance out of rotation without stopping it. The override is lifted when
+// ClearReadinessOverride is called or after :expiry if it is greater than zero
+func (h *HTTP) SetReadinessOverride(reason string, expiry time.Duration) error {
+	if h.readinessProbe == nil {
+		return fmt.Errorf("readiness probe is disabled")
+	}
+	h.readinessProbe.SetOverride(reason, expiry)
+	return nil
+}
+
+// ClearReadinessOverride lifts the override of the readiness probe and returns true
+// if one was active
+func (h *HTTP) ClearReadinessOverride() bool {
+	if h.readinessProbe == nil {
+		return false
+	}
+	return h.readinessProbe.ClearOverride()
+}
+
+// RemoveReadinessCheck removes the check named :name from the readiness probe and
+// returns true if it existed
+func (h *HTTP) RemoveReadinessCheck(name string) bool {
+	if h.readinessProbe == nil {
+		return false
+	}
+	return h.readinessProbe.RemoveCheck(name)
 }
 
 // Start starts the HTTP-based server
@@ -103,6 +402,7 @@ func (h *HTTP) Start() {
 	var tasks sync.WaitGroup
 	initialise(h)
 	defer denitialise(h)
+	h.lifecycleMetrics.observeStart(time.Now())
 	if !h.Options.Disable.SignalHandling {
 		go startSignalsHandler(h)
 	}
@@ -112,9 +412,13 @@ func (h *HTTP) Start() {
 	tasks.Wait()
 }
 
-// Stop terminates the server process gracefully
+// Stop terminates the server process gracefully, closing the server emits the
+// "server closed" event so only a failure to close is sent to the events channel
+// which is otherwise closed once the server has stopped
 func (h *HTTP) Stop() {
-	h.events <- h.Server.Close()
+	if err := h.Server.Close(); err != nil {
+		h.events <- err
+	}
 }
 
 // denitialise closes the channels that this Server instance uses to communicate events internally
@@ -140,6 +444,7 @@ func startHTTP(h *HTTP) {
 func startSignalsHandler(h *HTTP) {
 	signal.Notify(h.signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGKILL)
 	if sig := <-h.signals; sig != nil {
+		h.lifecycleMetrics.observeSignal(sig.String())
 		h.events <- fmt.Errorf("received signal: %s", sig.String())
 	}
 }
@@ -154,6 +459,7 @@ func startEventsHandler(h *HTTP, tasks *sync.WaitGroup) {
 			switch {
 			case strings.Contains(eventMessage, "http: Server closed"):
 				h.Server.ErrorLog.Printf("server was closed")
+				flushMetrics(h)
 				tasks.Done()
 				return
 			case strings.Contains(eventMessage, "bind: address already in use"):
@@ -175,6 +481,7 @@ func startEventsHandler(h *HTTP, tasks *sync.WaitGroup) {
 // handleShutdown iterates through the shutdown handlers, passing each the provided event :event
 // and leaving the handlers to do what they need to before allowing the Server instance to complete
 func handleShutdown(h *HTTP, event error) []error {
+	shutdownStart := time.Now()
 	errors := []error{}
 	if h.Options.ShutdownHandlers != nil {
 		h.Server.ErrorLog.Printf("running %v shutdown handlers...", len(h.Options.ShutdownHandlers))
@@ -187,8 +494,33 @@ func handleShutdown(h *HTTP, event error) []error {
 			h.Server.ErrorLog.Printf("shutdown handler %v succeeded", index)
 		}
 	}
+	h.lifecycleMetrics.observeShutdown(time.Since(shutdownStart), len(errors))
+	errors = append(errors, flushMetrics(h)...)
 	if len(errors) > 0 {
 		return errors
 	}
 	return nil
 }
+
+// flushMetrics sends the measurements buffered by the metrics sink and exports the
+// final metrics to the OpenTelemetry collector, this only happens the first time it
+// is called so that metrics are flushed once whether the server was stopped by a
+// signal or by HTTP.Stop
+func flushMetrics(h *HTTP) []error {
+	errors := []error{}
+	h.flushOnce.Do(func() {
+		if flusher, ok := h.Options.Metrics.Sink.(metrics.Flusher); ok {
+			if err := flusher.Flush(); err != nil {
+				h.Server.ErrorLog.Printf("failed to flush metrics: %s", err)
+				errors = append(errors, err)
+			}
+		}
+		if h.otlp != nil {
+			if err := h.otlp.Close(); err != nil {
+				h.Server.ErrorLog.Printf("failed to export metrics: %s", err)
+				errors = append(errors, err)
+			}
+		}
+	})
+	return errors
+}
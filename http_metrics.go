@@ -0,0 +1,119 @@
+package server
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/usvc/go-server/build"
+	"github.com/usvc/go-server/metrics"
+)
+
+const (
+	HTTPMetricsSinkStartTime               = "http.server.start_time"
+	HTTPMetricsSinkSignals                 = "http.server.signals"
+	HTTPMetricsSinkShutdownDuration        = "http.server.shutdown.duration"
+	HTTPMetricsSinkShutdownHandlerFailures = "http.server.shutdown_handler.failures"
+)
+
+// newHTTPMetrics registers the build information and lifecycle metrics of a server
+// with the :registerer and returns them. The :sink also receives lifecycle events if
+// it is not nil
+func newHTTPMetrics(registerer prometheus.Registerer, constLabels prometheus.Labels, version string, sink metrics.Sink) *httpMetrics {
+	m := &httpMetrics{sink: sink, tags: metrics.Tags(metrics.MergeLabels(constLabels))}
+	info := build.GetInfo()
+	buildInfo := metrics.Register(registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "build_info",
+		Help:        "Build information of the server, the value is always 1",
+		ConstLabels: constLabels,
+	}, []string{"version", "goversion", "revision", "path"})).(*prometheus.GaugeVec)
+	buildInfo.WithLabelValues(version, info.GoVersion, info.GetRevision(), info.Path).Set(1)
+	m.startTime = metrics.Register(registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "http_server_start_time_seconds",
+		Help:        "Time at which the server was started in seconds since the unix epoch",
+		ConstLabels: constLabels,
+	})).(prometheus.Gauge)
+	metrics.Register(registerer, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "http_server_uptime_seconds",
+		Help:        "Duration for which the server has been running in seconds",
+		ConstLabels: constLabels,
+	}, m.getUptime))
+	m.shutdownDuration = metrics.Register(registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "http_server_shutdown_duration_seconds",
+		Help:        "Duration of the last run of the shutdown handlers in seconds",
+		ConstLabels: constLabels,
+	})).(prometheus.Gauge)
+	m.signals = metrics.Register(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "http_server_signals_received_total",
+		Help:        "Number of signals received by the server",
+		ConstLabels: constLabels,
+	}, []string{"signal"})).(*prometheus.CounterVec)
+	m.shutdownHandlerFailures = metrics.Register(registerer, prometheus.NewCounter(prometheus.CounterOpts{
+		Name:        "http_server_shutdown_handler_failures_total",
+		Help:        "Number of shutdown handlers which returned an error",
+		ConstLabels: constLabels,
+	})).(prometheus.Counter)
+	return m
+}
+
+// httpMetrics records the lifecycle of a server, all methods are no-ops on a nil
+// instance so that they can be called when metrics are disabled
+type httpMetrics struct {
+	startTime               prometheus.Gauge
+	shutdownDuration        prometheus.Gauge
+	signals                 *prometheus.CounterVec
+	shutdownHandlerFailures prometheus.Counter
+	sink                    metrics.Sink
+	tags                    metrics.Tags
+	// started is the time the server was started in nanoseconds since the unix epoch
+	started int64
+}
+
+// observeStart records that the server started at :at
+func (m *httpMetrics) observeStart(at time.Time) {
+	if m == nil {
+		return
+	}
+	atomic.StoreInt64(&m.started, at.UnixNano())
+	m.startTime.Set(float64(at.UnixNano()) / float64(time.Second))
+	if m.sink != nil {
+		m.sink.Gauge(HTTPMetricsSinkStartTime, float64(at.Unix()), m.tags)
+	}
+}
+
+// observeSignal records that the server received the signal named :signal
+func (m *httpMetrics) observeSignal(signal string) {
+	if m == nil {
+		return
+	}
+	m.signals.WithLabelValues(signal).Inc()
+	if m.sink != nil {
+		m.sink.Count(HTTPMetricsSinkSignals, 1, metrics.MergeTags(m.tags, metrics.Tags{"signal": signal}))
+	}
+}
+
+// observeShutdown records that running the shutdown handlers took :duration and that
+// :failures of them returned an error
+func (m *httpMetrics) observeShutdown(duration time.Duration, failures int) {
+	if m == nil {
+		return
+	}
+	m.shutdownDuration.Set(duration.Seconds())
+	m.shutdownHandlerFailures.Add(float64(failures))
+	if m.sink != nil {
+		m.sink.Timing(HTTPMetricsSinkShutdownDuration, duration, m.tags)
+		if failures > 0 {
+			m.sink.Count(HTTPMetricsSinkShutdownHandlerFailures, float64(failures), m.tags)
+		}
+	}
+}
+
+// getUptime returns the number of seconds since the server was started or 0 if it
+// has not been started
+func (m *httpMetrics) getUptime() float64 {
+	started := atomic.LoadInt64(&m.started)
+	if started == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, started)).Seconds()
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/suite"
+)
+
+type HTTPMetricsTest struct {
+	suite.Suite
+}
+
+func TestHTTPMetrics(t *testing.T) {
+	suite.Run(t, &HTTPMetricsTest{})
+}
+
+func (s HTTPMetricsTest) Test_lifecycle() {
+	registry := prometheus.NewRegistry()
+	o := NewHTTPOptions()
+	o.Loggers.ServerEvent = func(args ...interface{}) {}
+	o.Service = HTTPService{Name: "expected-service"}
+	o.Version.Value = "1.2.3"
+	o.Metrics.Registerer = registry
+	o.ShutdownHandlers = HTTPShutdownHandlers{
+		func(error) error { return nil },
+		func(error) error { return fmt.Errorf("expected failure") },
+	}
+	sv := NewHTTP(o, http.NewServeMux())
+
+	families, err := registry.Gather()
+	s.Nil(err)
+	var buildInfo map[string]string
+	for _, family := range families {
+		if family.GetName() == "build_info" {
+			buildInfo = map[string]string{}
+			for _, label := range family.GetMetric()[0].GetLabel() {
+				buildInfo[label.GetName()] = label.GetValue()
+			}
+		}
+	}
+	s.Equal("1.2.3", buildInfo["version"])
+	s.Equal(runtime.Version(), buildInfo["goversion"])
+	s.Equal("expected-service", buildInfo["service"])
+	s.Contains(buildInfo, "revision")
+	s.Contains(buildInfo, "path")
+
+	uptime, err := testutil.GatherAndCount(registry, "http_server_uptime_seconds")
+	s.Nil(err)
+	s.Equal(1, uptime)
+	sv.lifecycleMetrics.observeStart(time.Now().Add(-time.Minute))
+	s.InDelta(60, sv.lifecycleMetrics.getUptime(), 1)
+
+	sv.lifecycleMetrics.observeSignal("terminated")
+	sv.lifecycleMetrics.observeSignal("terminated")
+	s.Len(handleShutdown(sv, fmt.Errorf("received signal: terminated")), 1)
+	expected := `
+# HELP http_server_shutdown_handler_failures_total Number of shutdown handlers which returned an error
+# TYPE http_server_shutdown_handler_failures_total counter
+http_server_shutdown_handler_failures_total{service="expected-service"} 1
+# HELP http_server_signals_received_total Number of signals received by the server
+# TYPE http_server_signals_received_total counter
+http_server_signals_received_total{service="expected-service",signal="terminated"} 2
+`
+	s.Nil(testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"http_server_shutdown_handler_failures_total",
+		"http_server_signals_received_total",
+	))
+	count, err := testutil.GatherAndCount(registry, "http_server_shutdown_duration_seconds", "http_server_start_time_seconds")
+	s.Nil(err)
+	s.Equal(2, count)
+}
+
+func (s HTTPMetricsTest) Test_disabled() {
+	o := NewHTTPOptions()
+	o.Loggers.ServerEvent = func(args ...interface{}) {}
+	o.Disable.Metrics = true
+	sv := NewHTTP(o, http.NewServeMux())
+	s.Nil(sv.lifecycleMetrics)
+	s.NotPanics(func() {
+		sv.lifecycleMetrics.observeStart(time.Now())
+		sv.lifecycleMetrics.observeSignal("interrupt")
+		handleShutdown(sv, fmt.Errorf("received signal: interrupt"))
+	})
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/usvc/go-server/handlers"
+	"github.com/usvc/go-server/middleware"
+)
+
+// httpRoutes records the patterns of the custom routes registered through the server
+type httpRoutes struct {
+	mutex    sync.RWMutex
+	patterns []string
+}
+
+// add records the route with the :pattern
+func (r *httpRoutes) add(pattern string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.patterns = append(r.patterns, pattern)
+}
+
+// list returns the recorded routes in the order they were registered
+func (r *httpRoutes) list() []handlers.ServiceDocumentRoute {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	routes := make([]handlers.ServiceDocumentRoute, 0, len(r.patterns))
+	for _, pattern := range r.patterns {
+		routes = append(routes, handlers.ServiceDocumentRoute{Pattern: pattern})
+	}
+	return routes
+}
+
+// getServiceDocument returns a function which builds the service document from the
+// :opts, the effective :corsConfig, the enabled built-in :endpoints and the custom
+// :routes registered so far
+func getServiceDocument(opts HTTPOptions, corsConfig middleware.CORSConfiguration, endpoints map[string]handlers.ServiceDocumentEndpoint, routes *httpRoutes) func() handlers.ServiceDocument {
+	var cors *handlers.ServiceDocumentCORS
+	if !opts.Disable.CORS {
+		cors = newServiceDocumentCORS(corsConfig)
+		for _, route := range corsConfig.Routes {
+			cors.Routes = append(cors.Routes, handlers.ServiceDocumentCORSRoute{
+				PathPrefix: route.PathPrefix,
+				Route:      route.Route,
+				Policy:     newServiceDocumentCORS(route.Policy),
+			})
+		}
+		cors.ExcludePaths = corsConfig.ExcludePaths
+	}
+	return func() handlers.ServiceDocument {
+		return handlers.ServiceDocument{
+			Name:      opts.Service.Name,
+			Version:   opts.Version.Value,
+			Endpoints: endpoints,
+			CORS:      cors,
+			Routes:    routes.list(),
+		}
+	}
+}
+
+// newServiceDocumentCORS describes the CORS policy :config without its routes and
+// excluded paths
+func newServiceDocumentCORS(config middleware.CORSConfiguration) *handlers.ServiceDocumentCORS {
+	return &handlers.ServiceDocumentCORS{
+		AllowCredentials:    config.AllowCredentials,
+		AllowHeaders:        nonNilStrings(config.AllowHeaders),
+		AllowMethods:        nonNilStrings(config.AllowMethods),
+		AllowOrigins:        nonNilStrings(config.AllowOrigins),
+		AllowOriginPatterns: config.AllowOriginPatterns,
+		AllowPrivateNetwork: config.AllowPrivateNetwork,
+		ExposeHeaders:       nonNilStrings(config.ExposeHeaders),
+		MaxAge:              int(config.MaxAge.Seconds()),
+		ReportOnly:          config.ReportOnly,
+	}
+}
+
+// newServiceDocumentEndpoint describes the built-in endpoint at :path, which is
+// protected if the :password is set or failed to load with :loadErr
+func newServiceDocumentEndpoint(path, password string, loadErr error) handlers.ServiceDocumentEndpoint {
+	return handlers.ServiceDocumentEndpoint{
+		Path:      path,
+		Protected: loadErr != nil || len(password) > 0,
+	}
+}
+
+// nonNilStrings returns :values or an empty slice if it is nil so that it is encoded
+// as an empty JSON array
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/suite"
+	"github.com/usvc/go-server/handlers"
+)
+
+type HTTPServiceDocumentTest struct {
+	suite.Suite
+}
+
+func TestHTTPServiceDocument(t *testing.T) {
+	suite.Run(t, &HTTPServiceDocumentTest{})
+}
+
+func (s HTTPServiceDocumentTest) getDocument(sv *HTTP) handlers.ServiceDocument {
+	recorder := httptest.NewRecorder()
+	sv.Server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, handlers.ServiceDocumentPath, nil))
+	s.Equal(http.StatusOK, recorder.Code)
+	var document handlers.ServiceDocument
+	s.Nil(json.Unmarshal(recorder.Body.Bytes(), &document))
+	return document
+}
+
+func (s HTTPServiceDocumentTest) Test_serviceDocument() {
+	o := NewHTTPOptions()
+	o.Loggers.ServerEvent = func(args ...interface{}) {}
+	o.Loggers.Request = func(args ...interface{}) {}
+	o.Metrics.Registerer = prometheus.NewRegistry()
+	o.Disable.ServiceDocument = false
+	o.Disable.StartupProbe = true
+	o.Metrics.Password = "expected-password"
+	o.Service.Name = "expected-service"
+	o.Version.Value = "1.2.3"
+	o.CORS.AllowOrigins = []string{"https://example.com"}
+	o.CORS.MaxAge = time.Minute
+	sv := NewHTTP(o, http.NewServeMux())
+	sv.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {})
+
+	document := s.getDocument(sv)
+	s.Equal("expected-service", document.Name)
+	s.Equal("1.2.3", document.Version)
+	s.Equal(map[string]handlers.ServiceDocumentEndpoint{
+		handlers.ServiceEndpointLiveness:  {Path: "/healthz"},
+		handlers.ServiceEndpointReadiness: {Path: "/readyz"},
+		handlers.ServiceEndpointMetrics:   {Path: "/metrics", Protected: true},
+		handlers.ServiceEndpointVersion:   {Path: "/version"},
+	}, document.Endpoints)
+	s.Equal(&handlers.ServiceDocumentCORS{
+		AllowHeaders:  []string{},
+		AllowMethods:  []string{http.MethodGet, http.MethodOptions, http.MethodPost},
+		AllowOrigins:  []string{"https://example.com"},
+		ExposeHeaders: []string{},
+		MaxAge:        60,
+		ExcludePaths:  []string{"/.well-known/service", "/healthz", "/metrics", "/readyz", "/version"},
+	}, document.CORS)
+	s.Equal([]handlers.ServiceDocumentRoute{{Pattern: "/api/"}}, document.Routes)
+
+	sv.Handle("/other", http.NotFoundHandler())
+	s.Len(s.getDocument(sv).Routes, 2, "routes registered later should be listed")
+}
+
+func (s HTTPServiceDocumentTest) Test_disabled() {
+	o := NewHTTPOptions()
+	o.Loggers.ServerEvent = func(args ...interface{}) {}
+	o.Loggers.Request = func(args ...interface{}) {}
+	o.Metrics.Registerer = prometheus.NewRegistry()
+	sv := NewHTTP(o, http.NewServeMux())
+	recorder := httptest.NewRecorder()
+	sv.Server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, handlers.ServiceDocumentPath, nil))
+	s.Equal(http.StatusNotFound, recorder.Code, "the service document should be disabled by default")
+
+	o.Disable.ServiceDocument = false
+	o.Disable.CORS = true
+	sv = NewHTTP(o, http.NewServeMux())
+	s.Nil(s.getDocument(sv).CORS)
+}
@@ -2,13 +2,22 @@ package server
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/suite"
+	"github.com/usvc/go-server/metrics"
+	"github.com/usvc/go-server/middleware"
+	"github.com/usvc/go-server/types"
 )
 
 type HTTPTest struct {
@@ -92,3 +101,247 @@ func (s HTTPTest) Test_e2e() {
 	s.Contains(serverEvents2Log, "'0.0.0.0:55555' is already in use")
 	s.Contains(serverEventsLog, "server was closed")
 }
+
+func (s HTTPTest) Test_runtimeChecks() {
+	o := NewHTTPOptions()
+	o.Loggers.ServerEvent = func(args ...interface{}) {}
+	o.Loggers.Request = func(args ...interface{}) {}
+	sv := NewHTTP(o, http.NewServeMux())
+	server := httptest.NewServer(sv.Server.Handler)
+	defer server.Close()
+
+	s.Nil(sv.AddReadinessCheck(types.HTTPProbeCheck{
+		Name:    "lazy-client",
+		Handler: func() error { return fmt.Errorf("not connected") },
+	}))
+	response, err := http.Get(server.URL + o.ReadinessProbe.Path)
+	s.Nil(err)
+	s.Equal(http.StatusInternalServerError, response.StatusCode)
+	response, err = http.Get(server.URL + o.ReadinessProbe.Path + "/lazy-client")
+	s.Nil(err)
+	s.Equal(http.StatusInternalServerError, response.StatusCode)
+
+	s.True(sv.RemoveReadinessCheck("lazy-client"))
+	response, err = http.Get(server.URL + o.ReadinessProbe.Path)
+	s.Nil(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+
+	s.Nil(sv.AddLivenessCheck(types.HTTPProbeCheck{Name: "deadlock", Handler: func() error { return nil }}))
+	s.True(sv.RemoveLivenessCheck("deadlock"))
+
+	o.Disable.LivenessProbe = true
+	sv = NewHTTP(o, http.NewServeMux())
+	s.NotNil(sv.AddLivenessCheck(types.HTTPProbeCheck{Name: "deadlock", Handler: func() error { return nil }}))
+	s.False(sv.RemoveLivenessCheck("deadlock"))
+}
+
+func (s HTTPTest) Test_readinessOverride() {
+	o := NewHTTPOptions()
+	o.Loggers.ServerEvent = func(args ...interface{}) {}
+	o.Loggers.Request = func(args ...interface{}) {}
+	o.Disable.ReadinessOverride = false
+	o.ReadinessProbe.Password = "expected"
+	sv := NewHTTP(o, http.NewServeMux())
+	server := httptest.NewServer(sv.Server.Handler)
+	defer server.Close()
+
+	s.Nil(sv.SetReadinessOverride("migrating", 0))
+	request, err := http.NewRequest(http.MethodGet, server.URL+o.ReadinessProbe.Path, nil)
+	s.Nil(err)
+	request.Header.Set("Authorization", "Bearer expected")
+	response, err := http.DefaultClient.Do(request)
+	s.Nil(err)
+	s.Equal(http.StatusInternalServerError, response.StatusCode)
+
+	request, err = http.NewRequest(http.MethodDelete, server.URL+o.ReadinessOverride.Path, nil)
+	s.Nil(err)
+	response, err = http.DefaultClient.Do(request)
+	s.Nil(err)
+	s.Equal(http.StatusUnauthorized, response.StatusCode, "the override endpoint should use the probe password")
+	request.Header.Set("Authorization", "Bearer expected")
+	response, err = http.DefaultClient.Do(request)
+	s.Nil(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+	s.False(sv.ClearReadinessOverride())
+}
+
+func (s HTTPTest) Test_customRegistry() {
+	o := NewHTTPOptions()
+	o.Loggers.ServerEvent = func(args ...interface{}) {}
+	o.Loggers.Request = func(args ...interface{}) {}
+	o.Service = HTTPService{Name: "expected-service", Instance: "expected-instance"}
+	o.Metrics.Registerer = prometheus.NewRegistry()
+	o.Metrics.ConstLabels = prometheus.Labels{"region": "expected-region"}
+	sv := NewHTTP(o, http.NewServeMux())
+	server := httptest.NewServer(sv.Server.Handler)
+	defer server.Close()
+
+	s.NotPanics(func() { NewHTTP(o, http.NewServeMux()) }, "servers should be able to share a registry")
+	other := NewHTTPOptions()
+	other.Metrics.Registerer = prometheus.NewRegistry()
+	s.NotPanics(func() { NewHTTP(other, http.NewServeMux()) }, "servers should be able to use separate registries")
+
+	response, err := http.Get(server.URL + o.ReadinessProbe.Path)
+	s.Nil(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+	response, err = http.Get(server.URL + o.Metrics.Path)
+	s.Nil(err)
+	body, err := ioutil.ReadAll(response.Body)
+	s.Nil(err)
+	s.Contains(string(body), `probe_status{instance="expected-instance",probe="readiness",region="expected-region",service="expected-service",status="ok"} 1`)
+	s.Contains(string(body), `http_server_requests_total{instance="expected-instance",method="GET",region="expected-region",route="/readyz",service="expected-service",status="2xx"} 1`)
+	s.NotContains(string(body), "go_goroutines", "metrics of the default registry should not be served")
+}
+
+func (s HTTPTest) Test_defaultMetricsHandler() {
+	o := NewHTTPOptions()
+	o.Loggers.ServerEvent = func(args ...interface{}) {}
+	o.Loggers.Request = func(args ...interface{}) {}
+	sv := NewHTTP(o, http.NewServeMux())
+	for scrape := 0; scrape < 2; scrape++ {
+		recorder := httptest.NewRecorder()
+		sv.Server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, o.Metrics.Path, nil))
+		s.Equal(http.StatusOK, recorder.Code)
+		if scrape > 0 {
+			s.Contains(recorder.Body.String(), `promhttp_metric_handler_requests_total{code="200"}`,
+				"the default registry should be served with the metrics of the handler")
+		}
+	}
+}
+
+func (s HTTPTest) Test_metricsSink() {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	s.Nil(err)
+	defer listener.Close()
+	statsd, err := metrics.NewStatsD(metrics.StatsDConfiguration{
+		Address:       listener.LocalAddr().String(),
+		FlushInterval: time.Hour,
+	})
+	s.Nil(err)
+	defer statsd.Close()
+
+	o := NewHTTPOptions()
+	o.Loggers.ServerEvent = func(args ...interface{}) {}
+	o.Loggers.Request = func(args ...interface{}) {}
+	o.Service = HTTPService{Name: "expected-service"}
+	o.Metrics.Registerer = prometheus.NewRegistry()
+	o.Metrics.Sink = statsd
+	sv := NewHTTP(o, http.NewServeMux())
+	server := httptest.NewServer(sv.Server.Handler)
+	defer server.Close()
+	_, err = http.Get(server.URL + o.ReadinessProbe.Path)
+	s.Nil(err)
+
+	s.Nil(handleShutdown(sv, fmt.Errorf("received signal: terminated")))
+	buffer := make([]byte, 65536)
+	listener.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := listener.ReadFrom(buffer)
+	s.Nil(err)
+	s.Contains(string(buffer[:n]), "http.server.requests:1|c|#method:GET,route:/readyz,service:expected-service,status:2xx",
+		"buffered metrics should be flushed on shutdown")
+}
+
+func (s HTTPTest) Test_metricsSinkStop() {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	s.Nil(err)
+	defer listener.Close()
+	statsd, err := metrics.NewStatsD(metrics.StatsDConfiguration{
+		Address:       listener.LocalAddr().String(),
+		FlushInterval: time.Hour,
+	})
+	s.Nil(err)
+	defer statsd.Close()
+
+	o := NewHTTPOptions()
+	o.Addr = HTTPAddr{Address: "127.0.0.1", Port: 0}
+	o.Loggers.ServerEvent = func(args ...interface{}) {}
+	o.Loggers.Request = func(args ...interface{}) {}
+	o.Disable.SignalHandling = true
+	o.Metrics.Registerer = prometheus.NewRegistry()
+	o.Metrics.Sink = statsd
+	sv := NewHTTP(o, http.NewServeMux())
+	statsd.Count("expected.measurement", 1, nil)
+	go func(after <-chan time.Time) {
+		<-after
+		sv.Stop()
+	}(time.After(s.latency))
+	sv.Start()
+
+	buffer := make([]byte, 65536)
+	listener.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := listener.ReadFrom(buffer)
+	s.Nil(err)
+	s.Contains(string(buffer[:n]), "expected.measurement:1|c", "buffered metrics should be flushed when stopped")
+	s.Empty(flushMetrics(sv), "metrics should only be flushed once")
+}
+
+func (s HTTPTest) Test_otlpMetrics() {
+	exports := make(chan map[string]interface{}, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var export map[string]interface{}
+		s.Nil(json.NewDecoder(r.Body).Decode(&export))
+		exports <- export
+	}))
+	defer receiver.Close()
+
+	o := NewHTTPOptions()
+	o.Loggers.ServerEvent = func(args ...interface{}) {}
+	o.Loggers.Request = func(args ...interface{}) {}
+	o.Service = HTTPService{Name: "expected-service", Instance: "expected-instance"}
+	o.Version.Value = "1.2.3"
+	o.Metrics.Registerer = prometheus.NewRegistry()
+	o.Disable.OTLPMetrics = false
+	o.Metrics.OTLP.Endpoint = receiver.URL + "/v1/metrics"
+	o.Metrics.OTLP.Interval = time.Hour
+	sv := NewHTTP(o, http.NewServeMux())
+	server := httptest.NewServer(sv.Server.Handler)
+	defer server.Close()
+	_, err := http.Get(server.URL + o.ReadinessProbe.Path)
+	s.Nil(err)
+	s.Len(exports, 0)
+
+	s.Nil(handleShutdown(sv, fmt.Errorf("received signal: terminated")))
+	s.Len(exports, 1, "metrics should be exported before shutdown completes")
+	export, err := json.Marshal(<-exports)
+	s.Nil(err)
+	s.Contains(string(export), `{"key":"service.name","value":{"stringValue":"expected-service"}}`)
+	s.Contains(string(export), `{"key":"service.version","value":{"stringValue":"1.2.3"}}`)
+	s.Contains(string(export), `{"key":"service.instance.id","value":{"stringValue":"expected-instance"}}`)
+	s.Contains(string(export), `"name":"http.server.requests"`)
+	s.Contains(string(export), `{"key":"route","value":{"stringValue":"/readyz"}}`)
+}
+
+func (s HTTPTest) Test_corsOperationalExclusion() {
+	o := NewHTTPOptions()
+	o.Loggers.ServerEvent = func(args ...interface{}) {}
+	o.Loggers.Request = func(args ...interface{}) {}
+	registry := prometheus.NewRegistry()
+	o.Metrics.Registerer = registry
+	o.CORS.AllowOrigins = []string{"https://app.example.com"}
+	o.CORS.Routes = []middleware.CORSRoute{
+		{PathPrefix: "/admin/", Policy: middleware.CORSConfiguration{AllowOrigins: []string{"https://admin.example.com"}}},
+	}
+	getAllowOrigin := func(sv *HTTP, path, origin string) string {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.Header.Set(middleware.CORSOrigin, origin)
+		recorder := httptest.NewRecorder()
+		sv.Server.Handler.ServeHTTP(recorder, request)
+		return recorder.Header().Get(middleware.CORSAccessControlAllowOrigin)
+	}
+
+	sv := NewHTTP(o, http.NewServeMux())
+	s.Equal("", getAllowOrigin(sv, "/healthz", "https://app.example.com"))
+	s.Equal("", getAllowOrigin(sv, "/readyz/database", "https://app.example.com"))
+	s.Equal("", getAllowOrigin(sv, "/metrics", "https://app.example.com"))
+	s.Equal("https://app.example.com", getAllowOrigin(sv, "/api", "https://app.example.com"))
+	s.Equal("https://admin.example.com", getAllowOrigin(sv, "/admin/users", "https://admin.example.com"))
+	s.Nil(o.CORS.ExcludePaths, "the options should not be modified")
+	s.Equal("", getAllowOrigin(sv, "/api", "https://evil.example.com"))
+	rejections, err := testutil.GatherAndCount(registry, "http_server_cors_rejections_total")
+	s.Nil(err)
+	s.Equal(1, rejections, "cors rejections should be registered with the metrics registerer")
+
+	o.Disable.CORSOperationalExclusion = true
+	sv = NewHTTP(o, http.NewServeMux())
+	s.Equal("https://app.example.com", getAllowOrigin(sv, "/healthz", "https://app.example.com"))
+}
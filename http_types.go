@@ -2,10 +2,18 @@ package server
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/usvc/go-server/build"
+	"github.com/usvc/go-server/handlers"
+	"github.com/usvc/go-server/metrics"
 	"github.com/usvc/go-server/middleware"
 	"github.com/usvc/go-server/types"
 )
@@ -26,19 +34,27 @@ func NewHTTPOptions() HTTPOptions {
 			MaxAge:            30 * time.Minute,
 		},
 		Disable: HTTPDisable{
-			CORS:              false,
-			LivenessProbe:     false,
-			Metrics:           false,
-			ReadinessProbe:    false,
-			RequestIdentifier: false,
-			RequestLogger:     false,
-			SignalHandling:    false,
-			Version:           false,
+			CORS:                     false,
+			CORSOperationalExclusion: false,
+			LivenessProbe:            false,
+			Metrics:                  false,
+			OTLPMetrics:              true,
+			ReadinessOverride:        true,
+			ReadinessProbe:           false,
+			RequestIdentifier:        false,
+			RequestLogger:            false,
+			RequestMetrics:           false,
+			RouteResolver:            false,
+			ServiceDocument:          true,
+			SignalHandling:           false,
+			StartupProbe:             false,
+			Version:                  false,
 		},
 		Limit: HTTPLimit{
 			HeaderBytes: 1024 * 100, // 100 kb
 		},
 		LivenessProbe: HTTPProbe{
+			Checks:   nil,
 			Handlers: nil,
 			Password: "",
 			Path:     "/healthz",
@@ -47,14 +63,51 @@ func NewHTTPOptions() HTTPOptions {
 			ServerEvent: log.Print,
 			Request:     log.Print,
 		},
-		Metrics: HTTPPath{
-			Path: "/metrics",
+		Metrics: HTTPMetrics{
+			ConstLabels: nil,
+			Gatherer:    nil,
+			OTLP: metrics.OTLPConfiguration{
+				Endpoint: metrics.DefaultOTLPEndpoint,
+				Interval: metrics.DefaultOTLPInterval,
+			},
+			Password:   "",
+			Path:       "/metrics",
+			Registerer: nil,
+			Sink:       nil,
+		},
+		ReadinessOverride: HTTPPath{
+			Password: "",
+			Path:     "/readyz-override",
 		},
 		ReadinessProbe: HTTPProbe{
+			Checks:   nil,
 			Handlers: nil,
 			Password: "",
 			Path:     "/readyz",
 		},
+		RequestMetrics: middleware.RequestMetricsConfiguration{
+			DurationBuckets: prometheus.DefBuckets,
+			SizeBuckets:     middleware.DefaultRequestMetricsSizeBuckets,
+		},
+		RouteResolver: middleware.RouteResolverConfiguration{
+			Normalizer: nil,
+			Routes:     nil,
+			Mux:        nil,
+		},
+		Service: HTTPService{
+			Instance: getHostname(),
+			Name:     filepath.Base(os.Args[0]),
+		},
+		ServiceDocument: HTTPPath{
+			Password: "",
+			Path:     handlers.ServiceDocumentPath,
+		},
+		StartupProbe: HTTPProbe{
+			Checks:   nil,
+			Handlers: nil,
+			Password: "",
+			Path:     "/startupz",
+		},
 		Timeouts: HTTPTimeouts{
 			Idle:       30 * time.Second,
 			Read:       3 * time.Second,
@@ -62,25 +115,32 @@ func NewHTTPOptions() HTTPOptions {
 			Write:      10 * time.Second,
 		},
 		Version: HTTPVersion{
-			Path:  "/version",
-			Value: "development",
+			Dependencies: false,
+			Path:         "/version",
+			Value:        build.GetInfo().Version,
 		},
 	}
 }
 
 type HTTPOptions struct {
-	Addr             HTTPAddr                     `json:"addr" yaml:"addr"`
-	CORS             middleware.CORSConfiguration `json:"cors" yaml:"cors"`
-	Disable          HTTPDisable                  `json:"enable" yaml:"enable"`
-	Limit            HTTPLimit                    `json:"limit" yaml:"limit"`
-	LivenessProbe    HTTPProbe                    `json:"livenessProbe" yaml:"livenessProbe"`
-	Metrics          HTTPPath                     `json:"metrics" yaml:"metrics"`
-	ReadinessProbe   HTTPProbe                    `json:"readinessProbe" yaml:"readinessProbe"`
-	Timeouts         HTTPTimeouts                 `json:"timeouts" yaml:"timeouts"`
-	Version          HTTPVersion                  `json:"version" yaml:"version"`
-	Middlewares      middleware.Middlewares
-	ShutdownHandlers HTTPShutdownHandlers
-	Loggers          HTTPLoggers
+	Addr              HTTPAddr                               `json:"addr" yaml:"addr"`
+	CORS              middleware.CORSConfiguration           `json:"cors" yaml:"cors"`
+	Disable           HTTPDisable                            `json:"enable" yaml:"enable"`
+	Limit             HTTPLimit                              `json:"limit" yaml:"limit"`
+	LivenessProbe     HTTPProbe                              `json:"livenessProbe" yaml:"livenessProbe"`
+	Metrics           HTTPMetrics                            `json:"metrics" yaml:"metrics"`
+	ReadinessOverride HTTPPath                               `json:"readinessOverride" yaml:"readinessOverride"`
+	ReadinessProbe    HTTPProbe                              `json:"readinessProbe" yaml:"readinessProbe"`
+	RequestMetrics    middleware.RequestMetricsConfiguration `json:"requestMetrics" yaml:"requestMetrics"`
+	RouteResolver     middleware.RouteResolverConfiguration  `json:"routeResolver" yaml:"routeResolver"`
+	Service           HTTPService                            `json:"service" yaml:"service"`
+	ServiceDocument   HTTPPath                               `json:"serviceDocument" yaml:"serviceDocument"`
+	StartupProbe      HTTPProbe                              `json:"startupProbe" yaml:"startupProbe"`
+	Timeouts          HTTPTimeouts                           `json:"timeouts" yaml:"timeouts"`
+	Version           HTTPVersion                            `json:"version" yaml:"version"`
+	Middlewares       middleware.Middlewares
+	ShutdownHandlers  HTTPShutdownHandlers
+	Loggers           HTTPLoggers
 }
 
 type HTTPAddr struct {
@@ -93,14 +153,23 @@ func (httpaddr HTTPAddr) String() string {
 }
 
 type HTTPDisable struct {
-	CORS              bool `json:"cors" yaml:"cors"`
-	LivenessProbe     bool `json:"livenessProbe" yaml:"livenessProbe"`
-	Metrics           bool `json:"metrics" yaml:"metrics"`
-	ReadinessProbe    bool `json:"readinessProbe" yaml:"readinessProbe"`
-	RequestIdentifier bool `json:"requestIdentifier" yaml:"requestIdentifier"`
-	RequestLogger     bool `json:"requestLogger" yaml:"requestLogger"`
-	SignalHandling    bool `json:"signalHandling" yaml:"signalHandling"`
-	Version           bool `json:"version" yaml:"version"`
+	CORS bool `json:"cors" yaml:"cors"`
+	// CORSOperationalExclusion when set applies CORS to the built-in endpoints and the
+	// service document, which are excluded from it by default
+	CORSOperationalExclusion bool `json:"corsOperationalExclusion" yaml:"corsOperationalExclusion"`
+	LivenessProbe            bool `json:"livenessProbe" yaml:"livenessProbe"`
+	Metrics                  bool `json:"metrics" yaml:"metrics"`
+	OTLPMetrics              bool `json:"otlpMetrics" yaml:"otlpMetrics"`
+	ReadinessOverride        bool `json:"readinessOverride" yaml:"readinessOverride"`
+	ReadinessProbe           bool `json:"readinessProbe" yaml:"readinessProbe"`
+	RequestIdentifier        bool `json:"requestIdentifier" yaml:"requestIdentifier"`
+	RequestLogger            bool `json:"requestLogger" yaml:"requestLogger"`
+	RequestMetrics           bool `json:"requestMetrics" yaml:"requestMetrics"`
+	RouteResolver            bool `json:"routeResolver" yaml:"routeResolver"`
+	ServiceDocument          bool `json:"serviceDocument" yaml:"serviceDocument"`
+	SignalHandling           bool `json:"signalHandling" yaml:"signalHandling"`
+	StartupProbe             bool `json:"startupProbe" yaml:"startupProbe"`
+	Version                  bool `json:"version" yaml:"version"`
 }
 
 type HTTPLimit struct {
@@ -121,15 +190,94 @@ func (lfel loggerFromExternalLogger) Write(what []byte) (int, error) {
 	return len(what), nil
 }
 
+type HTTPMetrics struct {
+	// ConstLabels are applied to all built-in metrics in addition to the service
+	// and instance labels from HTTPOptions.Service
+	ConstLabels prometheus.Labels `json:"constLabels" yaml:"constLabels"`
+	// Gatherer is served on the metrics endpoint, defaults to the Registerer if it
+	// is also a prometheus.Gatherer (eg. a *prometheus.Registry) and to
+	// prometheus.DefaultGatherer otherwise
+	Gatherer prometheus.Gatherer
+	// OTLP configures the export of built-in metrics to an OpenTelemetry collector
+	// when it is enabled via HTTPDisable.OTLPMetrics. The service name, version and
+	// instance are added to the resource attributes
+	OTLP         metrics.OTLPConfiguration `json:"otlp" yaml:"otlp"`
+	Password     string                    `json:"password" yaml:"password"`
+	PasswordEnv  string                    `json:"passwordEnv" yaml:"passwordEnv"`
+	PasswordFile string                    `json:"passwordFile" yaml:"passwordFile"`
+	Path         string                    `json:"path" yaml:"path"`
+	// Registerer is used to register all built-in metrics, defaults to
+	// prometheus.DefaultRegisterer
+	Registerer prometheus.Registerer
+	// Sink also receives the built-in metrics so that they can be exported to
+	// systems other than Prometheus (eg. metrics.NewStatsD). If it implements
+	// metrics.Flusher, it is flushed when the server shuts down
+	Sink metrics.Sink
+}
+
+func (httpmetrics HTTPMetrics) GetGatherer() prometheus.Gatherer {
+	if httpmetrics.Gatherer != nil {
+		return httpmetrics.Gatherer
+	}
+	if gatherer, ok := httpmetrics.Registerer.(prometheus.Gatherer); ok {
+		return gatherer
+	}
+	return prometheus.DefaultGatherer
+}
+
+func (httpmetrics HTTPMetrics) GetPassword() (string, error) {
+	return loadPassword(httpmetrics.Password, httpmetrics.PasswordEnv, httpmetrics.PasswordFile)
+}
+
+func (httpmetrics HTTPMetrics) GetRegisterer() prometheus.Registerer {
+	if httpmetrics.Registerer != nil {
+		return httpmetrics.Registerer
+	}
+	return prometheus.DefaultRegisterer
+}
+
+// getConstLabels returns the labels applied to all built-in metrics of the :service
+func (httpmetrics HTTPMetrics) getConstLabels(service HTTPService) prometheus.Labels {
+	serviceLabels := prometheus.Labels{}
+	if len(service.Name) > 0 {
+		serviceLabels["service"] = service.Name
+	}
+	if len(service.Instance) > 0 {
+		serviceLabels["instance"] = service.Instance
+	}
+	return metrics.MergeLabels(serviceLabels, httpmetrics.ConstLabels)
+}
+
 type HTTPPath struct {
-	Password string `json:"password" yaml:"password"`
-	Path     string `json:"path" yaml:"path"`
+	Password     string `json:"password" yaml:"password"`
+	PasswordEnv  string `json:"passwordEnv" yaml:"passwordEnv"`
+	PasswordFile string `json:"passwordFile" yaml:"passwordFile"`
+	Path         string `json:"path" yaml:"path"`
+}
+
+func (httppath HTTPPath) GetPassword() (string, error) {
+	return loadPassword(httppath.Password, httppath.PasswordEnv, httppath.PasswordFile)
 }
 
 type HTTPProbe struct {
-	Handlers types.HTTPProbeHandlers
-	Password string `json:"password" yaml:"password"`
-	Path     string `json:"path" yaml:"path"`
+	Checks       types.HTTPProbeChecks
+	Handlers     types.HTTPProbeHandlers
+	Password     string `json:"password" yaml:"password"`
+	PasswordEnv  string `json:"passwordEnv" yaml:"passwordEnv"`
+	PasswordFile string `json:"passwordFile" yaml:"passwordFile"`
+	Path         string `json:"path" yaml:"path"`
+}
+
+func (httpprobe HTTPProbe) GetPassword() (string, error) {
+	return loadPassword(httpprobe.Password, httpprobe.PasswordEnv, httpprobe.PasswordFile)
+}
+
+type HTTPService struct {
+	// Instance identifies this instance of the service, defaults to the hostname
+	Instance string `json:"instance" yaml:"instance"`
+	// Name identifies the service, this is reported as the service ID by probes
+	// responding in the application/health+json format
+	Name string `json:"name" yaml:"name"`
 }
 
 type HTTPShutdownHandlers []HTTPShutdownHandler
@@ -143,7 +291,53 @@ type HTTPTimeouts struct {
 }
 
 type HTTPVersion struct {
-	Path     string `json:"path" yaml:"path"`
-	Password string `json:"password" yaml:"password"`
-	Value    string `json:"value" yaml:"value"`
+	// Dependencies when set includes the versions of the modules the server was
+	// built with in JSON responses from the version endpoint
+	Dependencies bool   `json:"dependencies" yaml:"dependencies"`
+	Path         string `json:"path" yaml:"path"`
+	Password     string `json:"password" yaml:"password"`
+	PasswordEnv  string `json:"passwordEnv" yaml:"passwordEnv"`
+	PasswordFile string `json:"passwordFile" yaml:"passwordFile"`
+	Value        string `json:"value" yaml:"value"`
+}
+
+func (httpversion HTTPVersion) GetPassword() (string, error) {
+	return loadPassword(httpversion.Password, httpversion.PasswordEnv, httpversion.PasswordFile)
+}
+
+// getHostname returns the hostname or an empty string if it cannot be determined
+func getHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
+
+// loadPassword resolves a password from the file at :fromFile if it is set, from the
+// environment variable named :fromEnv if it is set, and otherwise returns :password;
+// a file or environment variable which is configured but empty is an error so that
+// the endpoint it protects is not left open
+func loadPassword(password, fromEnv, fromFile string) (string, error) {
+	if len(fromFile) > 0 {
+		contents, err := ioutil.ReadFile(fromFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password file: %s", err)
+		}
+		password := strings.TrimRight(string(contents), "\r\n")
+		if len(password) == 0 {
+			return "", fmt.Errorf("password file '%s' is empty", fromFile)
+		}
+		return password, nil
+	}
+	if len(fromEnv) > 0 {
+		value, ok := os.LookupEnv(fromEnv)
+		if !ok {
+			return "", fmt.Errorf("environment variable '%s' is not set", fromEnv)
+		} else if len(value) == 0 {
+			return "", fmt.Errorf("environment variable '%s' is empty", fromEnv)
+		}
+		return value, nil
+	}
+	return password, nil
 }
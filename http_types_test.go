@@ -0,0 +1,53 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type HTTPTypesTest struct {
+	suite.Suite
+}
+
+func TestHTTPTypes(t *testing.T) {
+	suite.Run(t, &HTTPTypesTest{})
+}
+
+func (s HTTPTypesTest) Test_loadPassword() {
+	password, err := loadPassword("literal", "", "")
+	s.Nil(err)
+	s.Equal("literal", password)
+
+	expectedEnvKey := "TEST_GO_SERVER_LOAD_PASSWORD"
+	os.Setenv(expectedEnvKey, "from env")
+	defer os.Unsetenv(expectedEnvKey)
+	password, err = loadPassword("literal", expectedEnvKey, "")
+	s.Nil(err)
+	s.Equal("from env", password)
+	_, err = loadPassword("literal", "TEST_GO_SERVER_LOAD_PASSWORD_UNSET", "")
+	s.NotNil(err)
+	emptyEnvKey := "TEST_GO_SERVER_LOAD_PASSWORD_EMPTY"
+	os.Setenv(emptyEnvKey, "")
+	defer os.Unsetenv(emptyEnvKey)
+	_, err = loadPassword("literal", emptyEnvKey, "")
+	s.NotNil(err, "an empty environment variable should not leave the endpoint open")
+
+	directory, err := ioutil.TempDir("", "go-server")
+	s.Nil(err)
+	defer os.RemoveAll(directory)
+	passwordFile := path.Join(directory, "password")
+	s.Nil(ioutil.WriteFile(passwordFile, []byte("from file\n"), 0600))
+	password, err = loadPassword("literal", expectedEnvKey, passwordFile)
+	s.Nil(err)
+	s.Equal("from file", password)
+	_, err = loadPassword("literal", "", path.Join(directory, "missing"))
+	s.NotNil(err)
+	emptyFile := path.Join(directory, "empty")
+	s.Nil(ioutil.WriteFile(emptyFile, []byte("\n"), 0600))
+	_, err = loadPassword("literal", "", emptyFile)
+	s.NotNil(err, "an empty password file should not leave the endpoint open")
+}
@@ -0,0 +1,375 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/usvc/go-server/types"
+)
+
+const (
+	DefaultOTLPEndpoint = "http://localhost:4318/v1/metrics"
+	DefaultOTLPInterval = time.Minute
+	DefaultOTLPTimeout  = 10 * time.Second
+	OTLPScopeName       = "github.com/usvc/go-server"
+	// otlpTemporalityCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE
+	otlpTemporalityCumulative = 2
+)
+
+var (
+	// DefaultOTLPBuckets are the explicit bounds of histograms without configured
+	// buckets, suitable for durations in seconds
+	DefaultOTLPBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+)
+
+type OTLPConfiguration struct {
+	// Endpoint is the URL of the OTLP/HTTP metrics receiver, defaults to
+	// DefaultOTLPEndpoint
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// Headers are added to export requests (eg. for authentication)
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	// Resource are the attributes describing the source of the metrics, such as
+	// service.name and service.version
+	Resource map[string]string `json:"resource" yaml:"resource"`
+	// Buckets are the explicit bounds of histograms by measurement name, histograms
+	// without buckets use DefaultOTLPBuckets
+	Buckets map[string][]float64
+	// Interval is the interval at which metrics are exported, defaults to
+	// DefaultOTLPInterval
+	Interval time.Duration `json:"interval" yaml:"interval"`
+	// Client sends the export requests, defaults to a client which times out after
+	// DefaultOTLPTimeout
+	Client *http.Client
+	// Log receives errors from exporting metrics in the background
+	Log types.Logger
+}
+
+// NewOTLP returns a Sink which aggregates measurements and exports them to an
+// OpenTelemetry collector using OTLP/HTTP with JSON encoding. Counts are exported as
+// cumulative sums, histograms and timings (in seconds) as cumulative histograms, and
+// gauges as their last value. Call Close to stop it and export the final values
+func NewOTLP(config OTLPConfiguration) (*OTLP, error) {
+	if len(config.Endpoint) == 0 {
+		config.Endpoint = DefaultOTLPEndpoint
+	}
+	if _, err := url.ParseRequestURI(config.Endpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse endpoint '%s': %s", config.Endpoint, err)
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultOTLPInterval
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: DefaultOTLPTimeout}
+	}
+	otlp := &OTLP{
+		config:    config,
+		startTime: time.Now(),
+		series:    map[string]*otlpSeries{},
+		done:      make(chan struct{}),
+	}
+	go otlp.exportPeriodically()
+	return otlp, nil
+}
+
+// OTLP is a Sink which exports measurements to an OpenTelemetry collector
+type OTLP struct {
+	config    OTLPConfiguration
+	startTime time.Time
+	mutex     sync.Mutex
+	series    map[string]*otlpSeries
+	// keys keeps the order in which series were first seen
+	keys      []string
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// otlpSeries is the aggregated state of a measurement with a set of tags
+type otlpSeries struct {
+	name         string
+	kind         string
+	tags         Tags
+	value        float64
+	count        uint64
+	bucketCounts []uint64
+	bounds       []float64
+}
+
+func (o *OTLP) Count(name string, value float64, tags Tags) {
+	o.record(name, "sum", value, tags)
+}
+
+func (o *OTLP) Gauge(name string, value float64, tags Tags) {
+	o.record(name, "gauge", value, tags)
+}
+
+func (o *OTLP) Histogram(name string, value float64, tags Tags) {
+	o.record(name, "histogram", value, tags)
+}
+
+func (o *OTLP) Timing(name string, value time.Duration, tags Tags) {
+	o.record(name, "histogram", value.Seconds(), tags)
+}
+
+// Flush exports the current values of all measurements
+func (o *OTLP) Flush() error {
+	payload := o.snapshot()
+	if payload == nil {
+		return nil
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics: %s", err)
+	}
+	request, err := http.NewRequest(http.MethodPost, o.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create export request: %s", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range o.config.Headers {
+		request.Header.Set(key, value)
+	}
+	response, err := o.config.Client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to export metrics: %s", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("failed to export metrics: received status %v: %s", response.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// Close stops exporting metrics in the background and exports the final values
+func (o *OTLP) Close() error {
+	err := fmt.Errorf("already closed")
+	o.closeOnce.Do(func() {
+		close(o.done)
+		err = o.Flush()
+	})
+	return err
+}
+
+// exportPeriodically exports metrics at the configured interval until closed
+func (o *OTLP) exportPeriodically() {
+	ticker := time.NewTicker(o.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-o.done:
+			return
+		case <-ticker.C:
+			if err := o.Flush(); err != nil && o.config.Log != nil {
+				o.config.Log(err.Error())
+			}
+		}
+	}
+}
+
+// record aggregates the :value of the measurement :name of :kind
+func (o *OTLP) record(name, kind string, value float64, tags Tags) {
+	key := name + "\x00" + formatOTLPTags(tags)
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	series, ok := o.series[key]
+	if !ok {
+		series = &otlpSeries{name: name, kind: kind, tags: MergeTags(tags)}
+		if kind == "histogram" {
+			series.bounds = o.config.Buckets[name]
+			if len(series.bounds) == 0 {
+				series.bounds = DefaultOTLPBuckets
+			}
+			series.bucketCounts = make([]uint64, len(series.bounds)+1)
+		}
+		o.series[key] = series
+		o.keys = append(o.keys, key)
+	}
+	switch kind {
+	case "sum":
+		series.value += value
+	case "gauge":
+		series.value = value
+	case "histogram":
+		series.value += value
+		series.count++
+		bucket := sort.SearchFloat64s(series.bounds, value)
+		series.bucketCounts[bucket]++
+	}
+}
+
+// snapshot returns the export request containing the current values of all
+// measurements or nil if nothing has been measured
+func (o *OTLP) snapshot() *otlpExportRequest {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if len(o.keys) == 0 {
+		return nil
+	}
+	startTime := strconv.FormatInt(o.startTime.UnixNano(), 10)
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	exported := []*otlpMetric{}
+	byName := map[string]*otlpMetric{}
+	for _, key := range o.keys {
+		series := o.series[key]
+		metric, ok := byName[series.name]
+		if !ok {
+			metric = &otlpMetric{Name: series.name}
+			switch series.kind {
+			case "sum":
+				metric.Sum = &otlpSum{AggregationTemporality: otlpTemporalityCumulative, IsMonotonic: true}
+			case "gauge":
+				metric.Gauge = &otlpGauge{}
+			case "histogram":
+				metric.Histogram = &otlpHistogram{AggregationTemporality: otlpTemporalityCumulative}
+			}
+			byName[series.name] = metric
+			exported = append(exported, metric)
+		}
+		attributes := toOTLPAttributes(series.tags)
+		switch {
+		case metric.Sum != nil && series.kind == "sum":
+			metric.Sum.DataPoints = append(metric.Sum.DataPoints, otlpNumberDataPoint{
+				Attributes:        attributes,
+				StartTimeUnixNano: startTime,
+				TimeUnixNano:      now,
+				AsDouble:          series.value,
+			})
+		case metric.Gauge != nil && series.kind == "gauge":
+			metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, otlpNumberDataPoint{
+				Attributes:   attributes,
+				TimeUnixNano: now,
+				AsDouble:     series.value,
+			})
+		case metric.Histogram != nil && series.kind == "histogram":
+			bucketCounts := make([]string, len(series.bucketCounts))
+			for index, count := range series.bucketCounts {
+				bucketCounts[index] = strconv.FormatUint(count, 10)
+			}
+			metric.Histogram.DataPoints = append(metric.Histogram.DataPoints, otlpHistogramDataPoint{
+				Attributes:        attributes,
+				StartTimeUnixNano: startTime,
+				TimeUnixNano:      now,
+				Count:             strconv.FormatUint(series.count, 10),
+				Sum:               series.value,
+				BucketCounts:      bucketCounts,
+				ExplicitBounds:    series.bounds,
+			})
+		}
+	}
+	return &otlpExportRequest{
+		ResourceMetrics: []otlpResourceMetrics{{
+			Resource: otlpResource{Attributes: toOTLPAttributes(o.config.Resource)},
+			ScopeMetrics: []otlpScopeMetrics{{
+				Scope:   otlpScope{Name: OTLPScopeName},
+				Metrics: exported,
+			}},
+		}},
+	}
+}
+
+// formatOTLPTags returns a stable representation of the :tags to identify a series
+func formatOTLPTags(tags Tags) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var formatted strings.Builder
+	for _, key := range keys {
+		formatted.WriteString(key + "\x00" + tags[key] + "\x00")
+	}
+	return formatted.String()
+}
+
+// toOTLPAttributes returns the :tags as OTLP attributes sorted by key
+func toOTLPAttributes(tags map[string]string) []otlpAttribute {
+	attributes := make([]otlpAttribute, 0, len(tags))
+	for key, value := range tags {
+		attributes = append(attributes, otlpAttribute{Key: key, Value: otlpAnyValue{StringValue: value}})
+	}
+	sort.Slice(attributes, func(i, j int) bool { return attributes[i].Key < attributes[j].Key })
+	return attributes
+}
+
+// the following types are the JSON encoding of an OTLP ExportMetricsServiceRequest
+// ref: https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/metrics/v1/metrics.proto
+
+type otlpExportRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope     `json:"scope"`
+	Metrics []*otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name      string         `json:"name"`
+	Sum       *otlpSum       `json:"sum,omitempty"`
+	Gauge     *otlpGauge     `json:"gauge,omitempty"`
+	Histogram *otlpHistogram `json:"histogram,omitempty"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                      `json:"aggregationTemporality"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          float64         `json:"asDouble"`
+}
+
+type otlpHistogramDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	Count             string          `json:"count"`
+	Sum               float64         `json:"sum"`
+	BucketCounts      []string        `json:"bucketCounts"`
+	ExplicitBounds    []float64       `json:"explicitBounds"`
+}
+
+type otlpAttribute struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
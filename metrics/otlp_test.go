@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type OTLPTests struct {
+	suite.Suite
+}
+
+func TestOTLP(t *testing.T) {
+	suite.Run(t, &OTLPTests{})
+}
+
+// receive returns an in-process OTLP/HTTP receiver which sends the decoded export
+// requests it receives to the returned channel, dropping them if it is full
+func (s OTLPTests) receive(statusCode int) (*httptest.Server, chan otlpExportRequest) {
+	requests := make(chan otlpExportRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Equal(http.MethodPost, r.Method)
+		s.Equal("/v1/metrics", r.URL.Path)
+		s.Equal("application/json", r.Header.Get("Content-Type"))
+		s.Equal("expected-token", r.Header.Get("Authorization"))
+		var request otlpExportRequest
+		s.Nil(json.NewDecoder(r.Body).Decode(&request))
+		select {
+		case requests <- request:
+		default:
+		}
+		w.WriteHeader(statusCode)
+	}))
+	return server, requests
+}
+
+func (s OTLPTests) Test_export() {
+	receiver, requests := s.receive(http.StatusOK)
+	defer receiver.Close()
+	otlp, err := NewOTLP(OTLPConfiguration{
+		Endpoint: receiver.URL + "/v1/metrics",
+		Headers:  map[string]string{"Authorization": "expected-token"},
+		Resource: map[string]string{"service.name": "expected-service", "service.version": "1.2.3"},
+		Buckets:  map[string][]float64{"size": {10, 100}},
+		Interval: time.Hour,
+	})
+	s.Nil(err)
+	defer otlp.Close()
+
+	s.Nil(otlp.Flush(), "nothing should be exported before anything is measured")
+	s.Len(requests, 0)
+
+	otlp.Count("requests", 1, Tags{"method": "GET"})
+	otlp.Count("requests", 2, Tags{"method": "GET"})
+	otlp.Count("requests", 1, Tags{"method": "POST"})
+	otlp.Gauge("in_flight", 3, nil)
+	otlp.Gauge("in_flight", 1, nil)
+	otlp.Histogram("size", 10, nil)
+	otlp.Histogram("size", 50, nil)
+	otlp.Histogram("size", 500, nil)
+	otlp.Timing("duration", 20*time.Millisecond, nil)
+	s.Nil(otlp.Flush())
+	request := <-requests
+
+	s.Len(request.ResourceMetrics, 1)
+	s.Equal([]otlpAttribute{
+		{Key: "service.name", Value: otlpAnyValue{StringValue: "expected-service"}},
+		{Key: "service.version", Value: otlpAnyValue{StringValue: "1.2.3"}},
+	}, request.ResourceMetrics[0].Resource.Attributes)
+	scope := request.ResourceMetrics[0].ScopeMetrics[0]
+	s.Equal(OTLPScopeName, scope.Scope.Name)
+	s.Len(scope.Metrics, 4)
+
+	requestsMetric := scope.Metrics[0]
+	s.Equal("requests", requestsMetric.Name)
+	s.True(requestsMetric.Sum.IsMonotonic)
+	s.Equal(otlpTemporalityCumulative, requestsMetric.Sum.AggregationTemporality)
+	s.Len(requestsMetric.Sum.DataPoints, 2)
+	s.Equal(float64(3), requestsMetric.Sum.DataPoints[0].AsDouble)
+	s.Equal("GET", requestsMetric.Sum.DataPoints[0].Attributes[0].Value.StringValue)
+	s.Equal(float64(1), requestsMetric.Sum.DataPoints[1].AsDouble)
+	s.NotEmpty(requestsMetric.Sum.DataPoints[0].StartTimeUnixNano)
+
+	inFlightMetric := scope.Metrics[1]
+	s.Equal("in_flight", inFlightMetric.Name)
+	s.Equal(float64(1), inFlightMetric.Gauge.DataPoints[0].AsDouble)
+
+	sizeMetric := scope.Metrics[2]
+	s.Equal("size", sizeMetric.Name)
+	s.Equal("3", sizeMetric.Histogram.DataPoints[0].Count)
+	s.Equal(float64(560), sizeMetric.Histogram.DataPoints[0].Sum)
+	s.Equal([]float64{10, 100}, sizeMetric.Histogram.DataPoints[0].ExplicitBounds)
+	s.Equal([]string{"1", "1", "1"}, sizeMetric.Histogram.DataPoints[0].BucketCounts)
+
+	durationMetric := scope.Metrics[3]
+	s.Equal("duration", durationMetric.Name)
+	s.Equal(0.02, durationMetric.Histogram.DataPoints[0].Sum, "timings should be exported in seconds")
+	s.Equal(DefaultOTLPBuckets, durationMetric.Histogram.DataPoints[0].ExplicitBounds)
+
+	otlp.Count("requests", 1, Tags{"method": "GET"})
+	s.Nil(otlp.Close())
+	request = <-requests
+	s.Equal(float64(4), request.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].Sum.DataPoints[0].AsDouble,
+		"sums should be cumulative and exported when closed")
+	s.NotNil(otlp.Close(), "closing twice should fail")
+}
+
+func (s OTLPTests) Test_periodicExport() {
+	receiver, requests := s.receive(http.StatusOK)
+	defer receiver.Close()
+	otlp, err := NewOTLP(OTLPConfiguration{
+		Endpoint: receiver.URL + "/v1/metrics",
+		Headers:  map[string]string{"Authorization": "expected-token"},
+		Interval: 5 * time.Millisecond,
+	})
+	s.Nil(err)
+	defer otlp.Close()
+	otlp.Count("requests", 1, nil)
+	select {
+	case request := <-requests:
+		s.Equal("requests", request.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].Name)
+	case <-time.After(time.Second):
+		s.Fail("metrics should be exported periodically")
+	}
+}
+
+func (s OTLPTests) Test_errors() {
+	receiver, _ := s.receive(http.StatusBadRequest)
+	defer receiver.Close()
+	otlp, err := NewOTLP(OTLPConfiguration{
+		Endpoint: receiver.URL + "/v1/metrics",
+		Headers:  map[string]string{"Authorization": "expected-token"},
+		Interval: time.Hour,
+	})
+	s.Nil(err)
+	otlp.Count("requests", 1, nil)
+	err = otlp.Close()
+	s.NotNil(err)
+	s.Contains(err.Error(), "received status 400")
+
+	_, err = NewOTLP(OTLPConfiguration{Endpoint: "not a url"})
+	s.NotNil(err)
+}
@@ -0,0 +1,32 @@
+// Package metrics provides helpers shared by the built-in metrics collectors
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Register registers the :collector with the :registerer and returns it. If an
+// equivalent collector has already been registered, the existing collector is
+// returned instead so that multiple servers can share the same registry
+func Register(registerer prometheus.Registerer, collector prometheus.Collector) prometheus.Collector {
+	if err := registerer.Register(collector); err != nil {
+		if alreadyRegistered, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return alreadyRegistered.ExistingCollector
+		}
+		panic(err)
+	}
+	return collector
+}
+
+// MergeLabels returns a single set of labels containing all of the :labels, later
+// sets take precedence over earlier ones. nil is returned if there are no labels
+func MergeLabels(labels ...prometheus.Labels) prometheus.Labels {
+	var merged prometheus.Labels
+	for _, set := range labels {
+		for name, value := range set {
+			if merged == nil {
+				merged = prometheus.Labels{}
+			}
+			merged[name] = value
+		}
+	}
+	return merged
+}
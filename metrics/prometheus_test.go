@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/suite"
+)
+
+type PrometheusTests struct {
+	suite.Suite
+}
+
+func TestPrometheus(t *testing.T) {
+	suite.Run(t, &PrometheusTests{})
+}
+
+func (s PrometheusTests) Test_Register() {
+	registry := prometheus.NewRegistry()
+	expectedOpts := prometheus.CounterOpts{Name: "testing_register", Help: "no need for this"}
+	first := prometheus.NewCounter(expectedOpts)
+	s.Equal(first, Register(registry, first))
+	second := prometheus.NewCounter(expectedOpts)
+	s.Equal(first, Register(registry, second), "existing collectors should be reused")
+
+	conflicting := prometheus.NewGauge(prometheus.GaugeOpts{Name: "testing_register", Help: "different"})
+	s.Panics(func() { Register(registry, conflicting) })
+}
+
+func (s PrometheusTests) Test_MergeLabels() {
+	s.Nil(MergeLabels())
+	s.Nil(MergeLabels(nil, prometheus.Labels{}))
+	s.Equal(prometheus.Labels{"service": "b", "instance": "c"}, MergeLabels(
+		prometheus.Labels{"service": "a"},
+		nil,
+		prometheus.Labels{"service": "b", "instance": "c"},
+	))
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Tags are the dimensions of a measurement sent to a Sink
+type Tags map[string]string
+
+// Sink receives measurements of the built-in metrics so that they can be exported to
+// systems other than Prometheus. Implementations must be safe for concurrent use
+type Sink interface {
+	// Count adds :value to the counter :name
+	Count(name string, value float64, tags Tags)
+	// Gauge sets the gauge :name to :value
+	Gauge(name string, value float64, tags Tags)
+	// Histogram records :value in the distribution :name
+	Histogram(name string, value float64, tags Tags)
+	// Timing records the duration :value in the timer :name
+	Timing(name string, value time.Duration, tags Tags)
+}
+
+// MergeTags returns a single set of tags containing all of the :tags, later sets take
+// precedence over earlier ones
+func MergeTags(tags ...Tags) Tags {
+	merged := Tags{}
+	for _, set := range tags {
+		for key, value := range set {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// Flusher is implemented by sinks which buffer measurements, Flush is called when the
+// server shuts down so that buffered measurements are not lost
+type Flusher interface {
+	Flush() error
+}
+
+// Sinks sends measurements to all of its sinks
+type Sinks []Sink
+
+func (sinks Sinks) Count(name string, value float64, tags Tags) {
+	for _, sink := range sinks {
+		sink.Count(name, value, tags)
+	}
+}
+
+func (sinks Sinks) Gauge(name string, value float64, tags Tags) {
+	for _, sink := range sinks {
+		sink.Gauge(name, value, tags)
+	}
+}
+
+func (sinks Sinks) Histogram(name string, value float64, tags Tags) {
+	for _, sink := range sinks {
+		sink.Histogram(name, value, tags)
+	}
+}
+
+func (sinks Sinks) Timing(name string, value time.Duration, tags Tags) {
+	for _, sink := range sinks {
+		sink.Timing(name, value, tags)
+	}
+}
+
+// Flush flushes all sinks which implement Flusher and returns an error listing the
+// sinks which failed to flush
+func (sinks Sinks) Flush() error {
+	errors := []string{}
+	for index, sink := range sinks {
+		if flusher, ok := sink.(Flusher); ok {
+			if err := flusher.Flush(); err != nil {
+				errors = append(errors, fmt.Sprintf("sink %v: %s", index, err))
+			}
+		}
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("failed to flush sinks: %s", strings.Join(errors, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SinkTests struct {
+	suite.Suite
+}
+
+func TestSink(t *testing.T) {
+	suite.Run(t, &SinkTests{})
+}
+
+type recordingSink struct {
+	measurements []string
+	flushErr     error
+}
+
+func (r *recordingSink) Count(name string, value float64, tags Tags) {
+	r.measurements = append(r.measurements, fmt.Sprintf("count %s %v %v", name, value, tags))
+}
+
+func (r *recordingSink) Gauge(name string, value float64, tags Tags) {
+	r.measurements = append(r.measurements, fmt.Sprintf("gauge %s %v %v", name, value, tags))
+}
+
+func (r *recordingSink) Histogram(name string, value float64, tags Tags) {
+	r.measurements = append(r.measurements, fmt.Sprintf("histogram %s %v %v", name, value, tags))
+}
+
+func (r *recordingSink) Timing(name string, value time.Duration, tags Tags) {
+	r.measurements = append(r.measurements, fmt.Sprintf("timing %s %v %v", name, value, tags))
+}
+
+func (r *recordingSink) Flush() error {
+	return r.flushErr
+}
+
+func (s SinkTests) Test_Sinks() {
+	first := &recordingSink{}
+	second := &recordingSink{flushErr: fmt.Errorf("expected error")}
+	sinks := Sinks{first, second}
+	sinks.Count("count", 1, Tags{"a": "b"})
+	sinks.Gauge("gauge", 2, nil)
+	sinks.Histogram("histogram", 3, nil)
+	sinks.Timing("timing", time.Second, nil)
+	expected := []string{
+		"count count 1 map[a:b]",
+		"gauge gauge 2 map[]",
+		"histogram histogram 3 map[]",
+		"timing timing 1s map[]",
+	}
+	s.Equal(expected, first.measurements)
+	s.Equal(expected, second.measurements)
+	err := sinks.Flush()
+	s.NotNil(err)
+	s.Contains(err.Error(), "sink 1: expected error")
+	s.Nil(Sinks{first}.Flush())
+}
+
+func (s SinkTests) Test_MergeTags() {
+	s.Equal(Tags{}, MergeTags())
+	s.Equal(Tags{"a": "2", "b": "1"}, MergeTags(Tags{"a": "1", "b": "1"}, nil, Tags{"a": "2"}))
+}
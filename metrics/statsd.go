@@ -0,0 +1,247 @@
+package metrics
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/usvc/go-server/types"
+)
+
+const (
+	DefaultStatsDAddress       = "127.0.0.1:8125"
+	DefaultStatsDFlushInterval = 100 * time.Millisecond
+	// DefaultStatsDMaxPacketSize keeps packets within the MTU of most networks
+	DefaultStatsDMaxPacketSize = 1432
+	// StatsDTagFormatDogStatsD appends tags as |#key:value,key:value
+	StatsDTagFormatDogStatsD = "dogstatsd"
+	// StatsDTagFormatInflux appends tags to the name as name,key=value,key=value
+	StatsDTagFormatInflux = "influx"
+	// StatsDTagFormatNone drops all tags for servers which do not support them
+	StatsDTagFormatNone = "none"
+)
+
+var (
+	statsDNameReplacer      = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", "\n", "_")
+	statsDDogStatsDReplacer = strings.NewReplacer("|", "_", "@", "_", "#", "_", ",", "_", "\n", "_")
+	statsDInfluxReplacer    = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", "=", "_", "\n", "_")
+)
+
+type StatsDConfiguration struct {
+	// Address of the StatsD server, defaults to DefaultStatsDAddress
+	Address string
+	// Prefix is prepended to the names of all measurements (eg. "service.")
+	Prefix string
+	// Tags are applied to all measurements, tags of a measurement take precedence
+	Tags Tags
+	// TagFormat is one of StatsDTagFormatDogStatsD (the default),
+	// StatsDTagFormatInflux or StatsDTagFormatNone
+	TagFormat string
+	// SampleRate is the fraction of counts, histograms and timings which are sent
+	// and must be greater than 0 and at most 1. Defaults to 1 which sends all of
+	// them. Gauges are never sampled
+	SampleRate float64
+	// MaxPacketSize is the size in bytes at which buffered measurements are sent,
+	// defaults to DefaultStatsDMaxPacketSize
+	MaxPacketSize int
+	// FlushInterval is the interval at which buffered measurements are sent,
+	// defaults to DefaultStatsDFlushInterval
+	FlushInterval time.Duration
+	// Log receives errors from sending measurements in the background
+	Log types.Logger
+}
+
+// NewStatsD returns a Sink which buffers measurements and sends them to a StatsD or
+// DogStatsD server over UDP. Call Close to stop it and send any buffered measurements
+func NewStatsD(config StatsDConfiguration) (*StatsD, error) {
+	if len(config.Address) == 0 {
+		config.Address = DefaultStatsDAddress
+	}
+	switch config.TagFormat {
+	case "":
+		config.TagFormat = StatsDTagFormatDogStatsD
+	case StatsDTagFormatDogStatsD, StatsDTagFormatInflux, StatsDTagFormatNone:
+	default:
+		return nil, fmt.Errorf("unknown tag format '%s'", config.TagFormat)
+	}
+	if config.SampleRate == 0 {
+		config.SampleRate = 1
+	}
+	if config.SampleRate < 0 || config.SampleRate > 1 {
+		return nil, fmt.Errorf("sample rate %v is not within (0, 1]", config.SampleRate)
+	}
+	if config.MaxPacketSize <= 0 {
+		config.MaxPacketSize = DefaultStatsDMaxPacketSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultStatsDFlushInterval
+	}
+	connection, err := net.Dial("udp", config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to '%s': %s", config.Address, err)
+	}
+	statsd := &StatsD{
+		config:     config,
+		connection: connection,
+		random:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		done:       make(chan struct{}),
+	}
+	go statsd.flushPeriodically()
+	return statsd, nil
+}
+
+// StatsD is a Sink which sends measurements to a StatsD or DogStatsD server
+type StatsD struct {
+	config     StatsDConfiguration
+	connection net.Conn
+	mutex      sync.Mutex
+	buffer     []byte
+	random     *rand.Rand
+	done       chan struct{}
+	closeOnce  sync.Once
+	// closed is set once the connection is closed so that later measurements are dropped
+	closed bool
+}
+
+func (s *StatsD) Count(name string, value float64, tags Tags) {
+	s.send(name, formatStatsDValue(value), "c", true, tags)
+}
+
+func (s *StatsD) Gauge(name string, value float64, tags Tags) {
+	s.send(name, formatStatsDValue(value), "g", false, tags)
+}
+
+// Histogram sends :value as a DogStatsD histogram or as a timer if the server does
+// not support tags since StatsD has no histogram type
+func (s *StatsD) Histogram(name string, value float64, tags Tags) {
+	metricType := "ms"
+	if s.config.TagFormat == StatsDTagFormatDogStatsD {
+		metricType = "h"
+	}
+	s.send(name, formatStatsDValue(value), metricType, true, tags)
+}
+
+func (s *StatsD) Timing(name string, value time.Duration, tags Tags) {
+	s.send(name, formatStatsDValue(float64(value)/float64(time.Millisecond)), "ms", true, tags)
+}
+
+// Flush sends all buffered measurements
+func (s *StatsD) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.flush()
+}
+
+// Close stops sending measurements in the background, sends all buffered measurements
+// and closes the connection
+func (s *StatsD) Close() error {
+	err := fmt.Errorf("already closed")
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.mutex.Lock()
+		err = s.flush()
+		s.closed = true
+		s.mutex.Unlock()
+		if closeErr := s.connection.Close(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
+
+// flush sends the buffer, the caller must hold the mutex
+func (s *StatsD) flush() error {
+	if len(s.buffer) == 0 {
+		return nil
+	}
+	_, err := s.connection.Write(s.buffer)
+	s.buffer = s.buffer[:0]
+	if err != nil {
+		return fmt.Errorf("failed to send measurements: %s", err)
+	}
+	return nil
+}
+
+// flushPeriodically flushes the buffer at the configured interval until closed
+func (s *StatsD) flushPeriodically() {
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil && s.config.Log != nil {
+				s.config.Log(err.Error())
+			}
+		}
+	}
+}
+
+// send buffers the measurement :name with the :value of :metricType, sampling it at
+// the configured rate if it is :sampled, measurements are dropped once closed
+func (s *StatsD) send(name, value, metricType string, sampled bool, tags Tags) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	sampleRate := float64(1)
+	if sampled {
+		sampleRate = s.config.SampleRate
+	}
+	if sampleRate < 1 && s.random.Float64() >= sampleRate {
+		return
+	}
+	line := s.format(name, value, metricType, sampleRate, tags)
+	if len(s.buffer) > 0 && len(s.buffer)+1+len(line) > s.config.MaxPacketSize {
+		if err := s.flush(); err != nil && s.config.Log != nil {
+			s.config.Log(err.Error())
+		}
+	}
+	if len(s.buffer) > 0 {
+		s.buffer = append(s.buffer, '\n')
+	}
+	s.buffer = append(s.buffer, line...)
+}
+
+// format returns the line of the measurement in the configured tag format
+func (s *StatsD) format(name, value, metricType string, sampleRate float64, tags Tags) string {
+	var line strings.Builder
+	line.WriteString(statsDNameReplacer.Replace(s.config.Prefix + name))
+	merged := MergeTags(s.config.Tags, tags)
+	keys := make([]string, 0, len(merged))
+	for key := range merged {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if s.config.TagFormat == StatsDTagFormatInflux {
+		for _, key := range keys {
+			line.WriteString("," + statsDInfluxReplacer.Replace(key) + "=" + statsDInfluxReplacer.Replace(merged[key]))
+		}
+	}
+	line.WriteString(":" + value + "|" + metricType)
+	if sampleRate < 1 {
+		line.WriteString("|@" + formatStatsDValue(sampleRate))
+	}
+	if s.config.TagFormat == StatsDTagFormatDogStatsD && len(keys) > 0 {
+		line.WriteString("|#")
+		for index, key := range keys {
+			if index > 0 {
+				line.WriteString(",")
+			}
+			line.WriteString(statsDDogStatsDReplacer.Replace(key) + ":" + statsDDogStatsDReplacer.Replace(merged[key]))
+		}
+	}
+	return line.String()
+}
+
+// formatStatsDValue returns the shortest representation of the :value
+func formatStatsDValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type StatsDTests struct {
+	suite.Suite
+}
+
+func TestStatsD(t *testing.T) {
+	suite.Run(t, &StatsDTests{})
+}
+
+// listen returns a local UDP listener and a function which returns the lines of the
+// next packet it receives
+func (s StatsDTests) listen() (net.PacketConn, func() []string) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	s.Nil(err)
+	return listener, func() []string {
+		buffer := make([]byte, 65536)
+		listener.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := listener.ReadFrom(buffer)
+		s.Nil(err)
+		return strings.Split(string(buffer[:n]), "\n")
+	}
+}
+
+func (s StatsDTests) Test_dogStatsD() {
+	listener, receive := s.listen()
+	defer listener.Close()
+	statsd, err := NewStatsD(StatsDConfiguration{
+		Address:       listener.LocalAddr().String(),
+		Prefix:        "service.",
+		Tags:          Tags{"env": "test", "route": "overridden"},
+		FlushInterval: time.Hour,
+	})
+	s.Nil(err)
+	defer statsd.Close()
+
+	statsd.Count("requests", 1, Tags{"route": "/users/:id", "method": "GET"})
+	statsd.Gauge("in_flight", 2.5, nil)
+	statsd.Histogram("size", 100, nil)
+	statsd.Timing("duration", 1500*time.Microsecond, nil)
+	s.Nil(statsd.Flush())
+	s.Equal([]string{
+		"service.requests:1|c|#env:test,method:GET,route:/users/:id",
+		"service.in_flight:2.5|g|#env:test,route:overridden",
+		"service.size:100|h|#env:test,route:overridden",
+		"service.duration:1.5|ms|#env:test,route:overridden",
+	}, receive())
+}
+
+func (s StatsDTests) Test_tagFormats() {
+	listener, receive := s.listen()
+	defer listener.Close()
+	statsd, err := NewStatsD(StatsDConfiguration{
+		Address:       listener.LocalAddr().String(),
+		TagFormat:     StatsDTagFormatInflux,
+		FlushInterval: time.Hour,
+	})
+	s.Nil(err)
+	statsd.Count("requests", 1, Tags{"status": "2xx", "method": "GET"})
+	statsd.Histogram("size", 100, nil)
+	s.Nil(statsd.Close())
+	s.Equal([]string{"requests,method=GET,status=2xx:1|c", "size:100|ms"}, receive())
+
+	statsd, err = NewStatsD(StatsDConfiguration{
+		Address:       listener.LocalAddr().String(),
+		TagFormat:     StatsDTagFormatNone,
+		FlushInterval: time.Hour,
+	})
+	s.Nil(err)
+	statsd.Count("requests", 1, Tags{"status": "2xx"})
+	s.Nil(statsd.Close())
+	s.Equal([]string{"requests:1|c"}, receive())
+
+	_, err = NewStatsD(StatsDConfiguration{TagFormat: "graphite"})
+	s.NotNil(err)
+}
+
+func (s StatsDTests) Test_sampling() {
+	listener, receive := s.listen()
+	defer listener.Close()
+	statsd, err := NewStatsD(StatsDConfiguration{
+		Address:       listener.LocalAddr().String(),
+		SampleRate:    0.5,
+		MaxPacketSize: 65000,
+		FlushInterval: time.Hour,
+	})
+	s.Nil(err)
+	for i := 0; i < 1000; i++ {
+		statsd.Count("requests", 1, nil)
+	}
+	statsd.Gauge("in_flight", 1, nil)
+	s.Nil(statsd.Close())
+	lines := receive()
+	s.InDelta(500, len(lines)-1, 100, "about half of the counts should be sent")
+	s.Equal("requests:1|c|@0.5", lines[0])
+	s.Equal("in_flight:1|g", lines[len(lines)-1], "gauges should not be sampled")
+
+	_, err = NewStatsD(StatsDConfiguration{SampleRate: 1.5})
+	s.NotNil(err)
+}
+
+func (s StatsDTests) Test_buffering() {
+	listener, receive := s.listen()
+	defer listener.Close()
+	statsd, err := NewStatsD(StatsDConfiguration{
+		Address:       listener.LocalAddr().String(),
+		MaxPacketSize: 25,
+		FlushInterval: time.Hour,
+	})
+	s.Nil(err)
+	defer statsd.Close()
+	statsd.Count("first", 1, nil)
+	statsd.Count("second", 1, nil)
+	statsd.Count("third", 1, nil)
+	s.Equal([]string{"first:1|c", "second:1|c"}, receive(), "packets should be sent when full")
+	s.Nil(statsd.Flush())
+	s.Equal([]string{"third:1|c"}, receive())
+
+	periodic, err := NewStatsD(StatsDConfiguration{
+		Address:       listener.LocalAddr().String(),
+		FlushInterval: 5 * time.Millisecond,
+	})
+	s.Nil(err)
+	defer periodic.Close()
+	periodic.Count("periodic", 1, nil)
+	s.Equal([]string{"periodic:1|c"}, receive(), "buffers should be flushed periodically")
+}
+
+func (s StatsDTests) Test_closed() {
+	listener, receive := s.listen()
+	defer listener.Close()
+	statsd, err := NewStatsD(StatsDConfiguration{
+		Address:       listener.LocalAddr().String(),
+		FlushInterval: time.Hour,
+	})
+	s.Nil(err)
+	statsd.Count("before", 1, nil)
+	s.Nil(statsd.Close())
+	s.Equal([]string{"before:1|c"}, receive())
+	statsd.Count("after", 1, nil)
+	s.Empty(statsd.buffer, "measurements should be dropped once closed")
+	s.Nil(statsd.Flush())
+	s.EqualError(statsd.Close(), "already closed")
+}
+
+func (s StatsDTests) Test_sanitize() {
+	listener, receive := s.listen()
+	defer listener.Close()
+	statsd, err := NewStatsD(StatsDConfiguration{
+		Address:       listener.LocalAddr().String(),
+		FlushInterval: time.Hour,
+	})
+	s.Nil(err)
+	statsd.Count("bad:name|c", 1, Tags{"bad,key": "bad|value#1"})
+	s.Nil(statsd.Close())
+	s.Equal([]string{"bad_name_c:1|c|#bad_key:bad_value_1"}, receive())
+	s.NotNil(statsd.Close(), "closing twice should fail")
+}
@@ -5,6 +5,10 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/usvc/go-server/metrics"
+	"github.com/usvc/go-server/types"
 )
 
 const (
@@ -12,133 +16,431 @@ const (
 	CORSAccessControlAllowHeaders     = "Access-Control-Allow-Headers"
 	CORSAccessControlAllowMethods     = "Access-Control-Allow-Methods"
 	CORSAccessControlAllowOrigin      = "Access-Control-Allow-Origin"
-	CORSAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
-	CORSAccessControlMaxAge           = "Access-Control-Max-Age"
-	CORSOrigin                        = "Origin"
-	CORSAccessControlRequestHeaders   = "Access-Control-Request-Headers"
-	CORSAccessControlRequestMethod    = "Access-Control-Request-Method"
+	// CORSAccessControlAllowPrivateNetwork allows a public website to make requests to
+	// a private network, ref: https://wicg.github.io/private-network-access/
+	CORSAccessControlAllowPrivateNetwork = "Access-Control-Allow-Private-Network"
+	CORSAccessControlExposeHeaders       = "Access-Control-Expose-Headers"
+	CORSAccessControlMaxAge              = "Access-Control-Max-Age"
+	CORSOrigin                           = "Origin"
+	CORSAccessControlRequestHeaders      = "Access-Control-Request-Headers"
+	CORSAccessControlRequestMethod       = "Access-Control-Request-Method"
+	// CORSAccessControlRequestPrivateNetwork is sent as "true" by browsers with
+	// preflight requests from a public website to a private network
+	CORSAccessControlRequestPrivateNetwork = "Access-Control-Request-Private-Network"
+	CORSVary                               = "Vary"
+
+	// corsWildcard allows any value when included in CORSConfiguration.AllowHeaders
+	// or CORSConfiguration.AllowMethods
+	corsWildcard = "*"
 )
 
 type CORSConfiguration struct {
 	// AllowCredentials sets the Access-Control-Allow-Credentials response header
 	// ref: https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS#access-control-allow-credentials
 	AllowCredentials bool
-	// AllowHeaders sets the Access-Control-Allow-Headers response header
-	// ref: https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS#access-control-allow-origin
+	// AllowHeaders sets the Access-Control-Allow-Headers response header of preflight
+	// requests, headers are matched case-insensitively and "*" allows any header
+	// ref: https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS#access-control-allow-headers
 	// request ref: https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS#access-control-request-headers
 	AllowHeaders []string
-	// AllowMethods sets the Access-Control-Allow-Methods response header
+	// AllowMethods sets the Access-Control-Allow-Methods response header of preflight
+	// requests, methods are matched case-sensitively and "*" allows any method
 	// ref: https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS#access-control-allow-methods
 	// request ref: https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS#access-control-request-method
 	AllowMethods []string
-	// AllowOrigins sets the Access-Control-Allow-Origin response header
+	// AllowOrigins sets the Access-Control-Allow-Origin response header. Origins are
+	// matched exactly unless they contain a "*" in place of subdomains (eg.
+	// "https://*.example.com") or are CORSAnyOrigin, which allows all origins and is
+	// echoed as "*" unless AllowCredentials is set, in which case the request origin
+	// is echoed since browsers reject "*" for credentialed requests
 	// ref: https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS#access-control-allow-origin
 	// request ref: https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS#origin
 	AllowOrigins []string
-	// EnablePassthrough enables the preflight request to hit the actual endpoint
+	// AllowOriginPatterns are regular expressions which allow the origins they match
+	// in their entirety in addition to AllowOrigins, an invalid expression causes a
+	// panic when the middleware is created
+	AllowOriginPatterns []string
+	// AllowOriginFunc when defined is consulted for origins which are not allowed by
+	// AllowOrigins or AllowOriginPatterns, it should return true if the :origin of the
+	// request :r is allowed
+	AllowOriginFunc func(origin string, r *http.Request) bool
+	// AllowOriginFuncCacheTTL when greater than zero caches the results of
+	// AllowOriginFunc by origin for the duration
+	AllowOriginFuncCacheTTL time.Duration
+	// AllowPrivateNetwork sets the Access-Control-Allow-Private-Network response header
+	// of preflight requests which have an Access-Control-Request-Private-Network header,
+	// such requests are rejected when it is not set. This is needed by services on a
+	// private network (eg. an intranet or localhost) which are called from websites on
+	// the public internet
+	// ref: https://wicg.github.io/private-network-access/#http-headerdef-access-control-allow-private-network
+	AllowPrivateNetwork bool
+	// EnablePassthrough enables the preflight request to hit the actual endpoint, which
+	// is then responsible for the response status
 	EnablePassthrough bool
-	// ExposeHeaders sets the Access-Control-Expose-Header response header
+	// ExposeHeaders sets the Access-Control-Expose-Headers response header of requests
+	// which are not preflight requests
 	// ref: https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS#access-control-expose-headers
 	ExposeHeaders []string
 	// MaxAge sets the Access-Control-Max-Age response header
 	// ref: https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS#access-control-max-age
 	MaxAge time.Duration
+	// Routes are policies which apply instead of this one to requests matching them,
+	// the first matching route is used. The Routes and ExcludePaths of their policies
+	// are ignored
+	Routes []CORSRoute
+	// ExcludePaths are paths which, along with their subpaths, are passed through
+	// without any CORS handling
+	ExcludePaths []string
+	// ReportOnly when set allows requests which the policy rejects as if they were
+	// allowed and logs the reason for the rejection to Log, so that the impact of
+	// a policy can be assessed before it is enforced
+	ReportOnly bool
+	// Log receives a message for every request allowed in report-only mode, logging
+	// is disabled if it is nil. Policies in Routes use the Log of this configuration
+	Log types.Logger
+	// Registerer when set is used to register http_server_cors_rejections_total, which
+	// counts rejected requests by reason including those allowed in report-only mode.
+	// Policies in Routes use the Registerer, ConstLabels and Sink of this configuration
+	Registerer prometheus.Registerer
+	// ConstLabels are applied to the rejections metric
+	ConstLabels prometheus.Labels
+	// Sink also receives the rejections if it is set, tagged with the ConstLabels
+	// and the reason
+	Sink metrics.Sink
 }
 
+// CORSRoute is a CORS policy for the requests matching PathPrefix or Route
+type CORSRoute struct {
+	// PathPrefix matches requests to the path and its subpaths, a trailing "/" is
+	// ignored so that "/admin" and "/admin/" match "/admin/users" but not "/administrator"
+	PathPrefix string
+	// Route matches requests resolved to it by NewRouteResolver or with paths matching
+	// it as a route template, where segments starting with ":" or enclosed in "{}"
+	// match any value and a trailing "*" matches any remaining segments
+	Route string
+	// Policy is applied to matching requests
+	Policy CORSConfiguration
+}
+
+// NewCORS returns a middleware which implements cross-origin resource sharing as
+// defined by the Fetch standard (ref: https://fetch.spec.whatwg.org/#http-cors-protocol).
+// Requests without an Origin header are passed through untouched. Preflight requests
+// are answered with a 204 if the origin, method and headers are allowed and with a
+// 400 without any Access-Control-Allow-* headers otherwise, unless EnablePassthrough
+// is set. Other requests from an allowed origin receive the Access-Control-Allow-Origin,
+// Access-Control-Allow-Credentials and Access-Control-Expose-Headers headers. Private
+// Network Access preflight requests are answered the same way, with the
+// Access-Control-Allow-Private-Network header set if AllowPrivateNetwork is set
 func NewCORS(config interface{}) Middleware {
 	conf := config.(CORSConfiguration)
-	allowedHeaders := map[string]bool{}
-	if conf.AllowHeaders != nil && len(conf.AllowHeaders) > 0 {
-		for _, allowedHeader := range conf.AllowHeaders {
-			allowedHeaders[http.CanonicalHeaderKey(allowedHeader)] = true
+	rejections := newCORSRejections(conf)
+	defaultPolicy := newCORSPolicy(conf, rejections)
+	routes := []corsRoute{}
+	for _, route := range conf.Routes {
+		routes = append(routes, newCORSRoute(route, rejections))
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isExcludedPath(conf.ExcludePaths, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			policy := defaultPolicy
+			for _, route := range routes {
+				if route.match(r) {
+					policy = route.policy
+					break
+				}
+			}
+			policy.serveHTTP(w, r, next)
+		})
+	}
+}
+
+// newCORSRoute returns the :route with its template split and its policy computed,
+// recording its rejections to :rejections
+func newCORSRoute(route CORSRoute, rejections *corsRejections) corsRoute {
+	compiled := corsRoute{
+		pathPrefix: route.PathPrefix,
+		route:      route.Route,
+		policy:     newCORSPolicy(route.Policy, rejections),
+	}
+	if len(route.Route) > 0 {
+		compiled.routeSegments = splitRoute(route.Route)
+	}
+	return compiled
+}
+
+type corsRoute struct {
+	pathPrefix    string
+	route         string
+	routeSegments []string
+	policy        *corsPolicy
+}
+
+// match returns true if the request :r has the path prefix of the route or matches
+// its route template, either as resolved by NewRouteResolver or by its path
+func (c corsRoute) match(r *http.Request) bool {
+	if len(c.pathPrefix) > 0 && hasPathPrefix(r.URL.Path, c.pathPrefix) {
+		return true
+	}
+	if c.routeSegments == nil {
+		return false
+	}
+	return GetRequestRoute(r) == c.route || matchRoute(c.routeSegments, splitRoute(r.URL.Path))
+}
+
+// isExcludedPath returns true if the :path is one of the :excludedPaths or one of
+// their subpaths
+func isExcludedPath(excludedPaths []string, path string) bool {
+	for _, excludedPath := range excludedPaths {
+		if hasPathPrefix(path, excludedPath) {
+			return true
 		}
 	}
-	allowedMethods := map[string]bool{}
-	if conf.AllowMethods != nil && len(conf.AllowMethods) > 0 {
-		for _, allowedMethod := range conf.AllowMethods {
-			allowedMethods[allowedMethod] = true
+	return false
+}
+
+// hasPathPrefix returns true if the :path is the :prefix or one of its subpaths,
+// ignoring a trailing "/" in the :prefix so that only whole segments are matched
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// newCORSPolicy returns the policy defined by :conf with its response header values
+// computed ahead of requests, recording its rejections to :rejections
+func newCORSPolicy(conf CORSConfiguration, rejections *corsRejections) *corsPolicy {
+	policy := &corsPolicy{
+		reportOnly:          conf.ReportOnly,
+		rejections:          rejections,
+		enablePassthrough:   conf.EnablePassthrough,
+		allowCredentials:    conf.AllowCredentials,
+		allowPrivateNetwork: conf.AllowPrivateNetwork,
+		origins:             newCORSOriginMatcher(conf.AllowOrigins, conf.AllowOriginPatterns),
+		allowOriginFunc:     conf.AllowOriginFunc,
+		methods:             map[string]bool{},
+		headers:             map[string]bool{},
+		allowMethods:        strings.Join(conf.AllowMethods, ", "),
+		allowHeaders:        strings.Join(conf.AllowHeaders, ", "),
+		exposeHeaders:       strings.Join(conf.ExposeHeaders, ", "),
+	}
+	if policy.allowOriginFunc != nil && conf.AllowOriginFuncCacheTTL > 0 {
+		policy.allowOriginFunc = newCORSOriginCache(conf.AllowOriginFunc, conf.AllowOriginFuncCacheTTL).allow
+	}
+	for _, method := range conf.AllowMethods {
+		if method == corsWildcard {
+			policy.anyMethod = true
 		}
+		policy.methods[method] = true
 	}
-	allowedOrigins := map[string]bool{}
-	if conf.AllowOrigins != nil && len(conf.AllowOrigins) > 0 {
-		for _, allowedOrigin := range conf.AllowOrigins {
-			allowedOrigins[allowedOrigin] = true
+	for _, header := range conf.AllowHeaders {
+		if header == corsWildcard {
+			policy.anyHeader = true
 		}
+		policy.headers[strings.ToLower(header)] = true
 	}
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			requestHeaders := strings.Split(r.Header.Get(CORSAccessControlRequestHeaders), ",")
-			if len(requestHeaders) > 0 {
-				w.Header().Add("Vary", CORSAccessControlRequestHeaders)
-			}
-			requestMethod := r.Method
-			if r.Header.Get(CORSAccessControlRequestMethod) != "" {
-				requestMethod = r.Header.Get(CORSAccessControlRequestMethod)
-				w.Header().Add("Vary", CORSAccessControlRequestMethod)
-			}
-			requestOrigin := r.Header.Get(CORSOrigin)
-			if len(requestOrigin) > 0 {
-				w.Header().Add("Vary", CORSOrigin)
-			}
-			success := true
+	if seconds := int64(conf.MaxAge / time.Second); seconds > 0 {
+		policy.maxAge = strconv.FormatInt(seconds, 10)
+	}
+	return policy
+}
 
-			_, originAllowed := allowedOrigins[requestOrigin]
-			if originAllowed {
-				w.Header().Add(CORSAccessControlAllowOrigin, requestOrigin)
-			}
-			if len(requestOrigin) > 0 {
-				success = success && originAllowed
-			}
+// corsPolicy decides whether cross-origin requests are allowed and writes the
+// corresponding response headers
+type corsPolicy struct {
+	reportOnly          bool
+	rejections          *corsRejections
+	enablePassthrough   bool
+	allowCredentials    bool
+	allowPrivateNetwork bool
+	origins             *corsOriginMatcher
+	allowOriginFunc     func(string, *http.Request) bool
+	methods             map[string]bool
+	anyMethod           bool
+	// headers are the lowercased allowed headers
+	headers       map[string]bool
+	anyHeader     bool
+	allowMethods  string
+	allowHeaders  string
+	exposeHeaders string
+	maxAge        string
+}
 
-			_, methodAllowed := allowedMethods[requestMethod]
-			if methodAllowed {
-				w.Header().Add(CORSAccessControlAllowMethods, requestMethod)
-			}
-			if len(requestMethod) > 0 {
-				success = success && methodAllowed
-			}
+// serveHTTP applies the policy to the request :r, answering preflight requests
+// unless passthrough is enabled and calling :next otherwise
+func (p *corsPolicy) serveHTTP(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if p.variesByOrigin() {
+		addVary(w.Header(), CORSOrigin)
+	}
+	requestOrigin := r.Header.Get(CORSOrigin)
+	if len(requestOrigin) == 0 {
+		next.ServeHTTP(w, r)
+		return
+	}
 
-			for i := 0; i < len(requestHeaders); i++ {
-				requestHeaders[i] = http.CanonicalHeaderKey(strings.Trim(requestHeaders[i], " "))
-			}
-			allowHeaders := []string{}
-			allHeadersFound := true
-			for _, key := range requestHeaders {
-				_, allowed := allowedHeaders[key]
-				allHeadersFound = allHeadersFound && allowed
-				if allowed {
-					allowHeaders = append(allowHeaders, key)
-				}
-			}
-			if allHeadersFound {
-				w.Header().Add(CORSAccessControlAllowHeaders, strings.Join(allowHeaders, ","))
+	if !isPreflight(r) {
+		allowed := p.allowOrigin(requestOrigin, r)
+		if !allowed {
+			p.rejections.observe(r, CORSRejectionOrigin, requestOrigin, p.reportOnly)
+		}
+		if allowed || p.reportOnly {
+			p.writeAllowOrigin(w.Header(), requestOrigin)
+			if len(p.exposeHeaders) > 0 {
+				w.Header().Set(CORSAccessControlExposeHeaders, p.exposeHeaders)
 			}
-			success = success && allHeadersFound
+		}
+		next.ServeHTTP(w, r)
+		return
+	}
 
-			if conf.AllowCredentials {
-				w.Header().Add(CORSAccessControlAllowCredentials, "true")
-			}
+	addVary(w.Header(), CORSAccessControlRequestMethod, CORSAccessControlRequestHeaders, CORSAccessControlRequestPrivateNetwork)
+	rejection, rejectedValue := p.checkPreflight(r)
+	if len(rejection) > 0 {
+		p.rejections.observe(r, rejection, rejectedValue, p.reportOnly)
+	}
+	if len(rejection) == 0 || p.reportOnly {
+		p.writePreflight(w.Header(), r)
+	}
+	if p.enablePassthrough {
+		next.ServeHTTP(w, r)
+		return
+	}
+	if len(rejection) > 0 && !p.reportOnly {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-			if r.Method == http.MethodOptions && r.Header.Get(CORSAccessControlRequestMethod) != "" {
-				if conf.MaxAge > 0 {
-					w.Header().Add(CORSAccessControlMaxAge, strconv.FormatUint(uint64(conf.MaxAge.Seconds()), 10))
-				}
+// variesByOrigin returns false if responses are the same for every origin, which is
+// the case when any origin is allowed without credentials
+func (p *corsPolicy) variesByOrigin() bool {
+	return !p.origins.any || p.allowCredentials
+}
 
-				if !conf.EnablePassthrough {
-					if success {
-						w.WriteHeader(http.StatusNoContent)
-					} else {
-						w.WriteHeader(http.StatusBadRequest)
-					}
-					return
-				}
+// allowOrigin returns true if the :origin of the request :r is allowed
+func (p *corsPolicy) allowOrigin(origin string, r *http.Request) bool {
+	if p.origins.match(origin) {
+		return true
+	}
+	return p.allowOriginFunc != nil && p.allowOriginFunc(origin, r)
+}
+
+// checkPreflight returns the reason the preflight request :r is rejected for, which
+// is one of the CORSRejection* constants, and the value which is not allowed, or empty
+// strings if it is allowed
+func (p *corsPolicy) checkPreflight(r *http.Request) (string, string) {
+	if origin := r.Header.Get(CORSOrigin); !p.allowOrigin(origin, r) {
+		return CORSRejectionOrigin, origin
+	}
+	if method := r.Header.Get(CORSAccessControlRequestMethod); !p.anyMethod && !p.methods[method] && !isCORSSafelistedMethod(method) {
+		return CORSRejectionMethod, method
+	}
+	if !p.anyHeader {
+		for _, header := range parseCORSHeaderList(r.Header.Values(CORSAccessControlRequestHeaders)) {
+			if !p.headers[header] {
+				return CORSRejectionHeader, header
 			}
+		}
+	}
+	if isPrivateNetworkPreflight(r) && !p.allowPrivateNetwork {
+		return CORSRejectionPrivateNetwork, r.Header.Get(CORSAccessControlRequestPrivateNetwork)
+	}
+	return "", ""
+}
+
+// isCORSSafelistedMethod returns true if the :method is always allowed by browsers
+// whether or not it is listed in Access-Control-Allow-Methods
+// ref: https://fetch.spec.whatwg.org/#cors-safelisted-method
+func isCORSSafelistedMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodPost
+}
 
-			if conf.ExposeHeaders != nil && len(conf.ExposeHeaders) > 0 {
-				w.Header().Add(CORSAccessControlExposeHeaders, strings.Join(conf.ExposeHeaders, ","))
+// writeAllowOrigin writes the headers allowing the :origin to read the response
+func (p *corsPolicy) writeAllowOrigin(header http.Header, origin string) {
+	if p.origins.any && !p.allowCredentials {
+		header.Set(CORSAccessControlAllowOrigin, CORSAnyOrigin)
+	} else {
+		header.Set(CORSAccessControlAllowOrigin, origin)
+	}
+	if p.allowCredentials {
+		header.Set(CORSAccessControlAllowCredentials, "true")
+	}
+}
+
+// writePreflight writes the headers of a successful response to the preflight
+// request :r. Wildcards are answered with the requested method and headers since
+// browsers do not honour them for credentialed requests
+func (p *corsPolicy) writePreflight(header http.Header, r *http.Request) {
+	p.writeAllowOrigin(header, r.Header.Get(CORSOrigin))
+	if p.anyMethod {
+		header.Set(CORSAccessControlAllowMethods, r.Header.Get(CORSAccessControlRequestMethod))
+	} else if len(p.allowMethods) > 0 {
+		header.Set(CORSAccessControlAllowMethods, p.allowMethods)
+	}
+	if p.anyHeader {
+		if requestHeaders := parseCORSHeaderList(r.Header.Values(CORSAccessControlRequestHeaders)); len(requestHeaders) > 0 {
+			header.Set(CORSAccessControlAllowHeaders, strings.Join(requestHeaders, ", "))
+		}
+	} else if len(p.allowHeaders) > 0 {
+		header.Set(CORSAccessControlAllowHeaders, p.allowHeaders)
+	}
+	if len(p.maxAge) > 0 {
+		header.Set(CORSAccessControlMaxAge, p.maxAge)
+	}
+	if isPrivateNetworkPreflight(r) {
+		header.Set(CORSAccessControlAllowPrivateNetwork, "true")
+	}
+}
+
+// isPreflight returns true if :r is a CORS preflight request
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		len(r.Header.Get(CORSOrigin)) > 0 &&
+		len(r.Header.Get(CORSAccessControlRequestMethod)) > 0
+}
+
+// isPrivateNetworkPreflight returns true if the preflight request :r is for a request
+// from a public website to a private network
+func isPrivateNetworkPreflight(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get(CORSAccessControlRequestPrivateNetwork), "true")
+}
+
+// parseCORSHeaderList returns the lowercased non-empty header names in the
+// comma-separated lists :values
+func parseCORSHeaderList(values []string) []string {
+	headers := []string{}
+	for _, value := range values {
+		for _, header := range strings.Split(value, ",") {
+			if header = strings.TrimSpace(header); len(header) > 0 {
+				headers = append(headers, strings.ToLower(header))
 			}
+		}
+	}
+	return headers
+}
 
-			next.ServeHTTP(w, r)
-		})
+// addVary adds the :names to the Vary header of :header unless they are already
+// listed, merging all values into a single comma-separated header
+func addVary(header http.Header, names ...string) {
+	existing := []string{}
+	listed := map[string]bool{}
+	for _, name := range parseCORSHeaderList(header.Values(CORSVary)) {
+		if name == corsWildcard {
+			return
+		}
+		if !listed[name] {
+			listed[name] = true
+			existing = append(existing, http.CanonicalHeaderKey(name))
+		}
+	}
+	vary := existing
+	for _, name := range names {
+		if !listed[strings.ToLower(name)] {
+			listed[strings.ToLower(name)] = true
+			vary = append(vary, name)
+		}
 	}
+	header.Set(CORSVary, strings.Join(vary, ", "))
 }
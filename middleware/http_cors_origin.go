@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CORSAnyOrigin allows requests from any origin when included in
+	// CORSConfiguration.AllowOrigins
+	CORSAnyOrigin = "*"
+	// corsOriginCacheMaxEntries is the number of origins above which expired entries
+	// are evicted from the cache of CORSConfiguration.AllowOriginFunc results
+	corsOriginCacheMaxEntries = 10000
+)
+
+// newCORSOriginMatcher returns a matcher of the :origins, which are matched exactly
+// unless they are CORSAnyOrigin or contain a "*" in place of subdomains, and of the
+// regular expressions :patterns, which must match an origin in its entirety
+func newCORSOriginMatcher(origins []string, patterns []string) *corsOriginMatcher {
+	matcher := &corsOriginMatcher{exact: map[string]bool{}}
+	for _, origin := range origins {
+		origin = strings.ToLower(origin)
+		if origin == CORSAnyOrigin {
+			matcher.any = true
+		} else if wildcard := strings.Index(origin, "*"); wildcard >= 0 {
+			matcher.wildcards = append(matcher.wildcards, corsWildcardOrigin{
+				prefix: origin[:wildcard],
+				suffix: origin[wildcard+1:],
+			})
+		} else {
+			matcher.exact[origin] = true
+		}
+	}
+	for _, pattern := range patterns {
+		matcher.patterns = append(matcher.patterns, regexp.MustCompile("^(?:"+pattern+")$"))
+	}
+	return matcher
+}
+
+type corsOriginMatcher struct {
+	// any is true if all origins are allowed
+	any       bool
+	exact     map[string]bool
+	wildcards []corsWildcardOrigin
+	patterns  []*regexp.Regexp
+}
+
+// corsWildcardOrigin matches origins such as "https://*.example.com", where the "*"
+// stands for one or more subdomains
+type corsWildcardOrigin struct {
+	prefix string
+	suffix string
+}
+
+// match returns true if the :origin is allowed
+func (m *corsOriginMatcher) match(origin string) bool {
+	if len(origin) == 0 {
+		return false
+	}
+	if m.any {
+		return true
+	}
+	lowerOrigin := strings.ToLower(origin)
+	if m.exact[lowerOrigin] {
+		return true
+	}
+	for _, wildcard := range m.wildcards {
+		if wildcard.match(lowerOrigin) {
+			return true
+		}
+	}
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns true if the lowercased :origin has the prefix and suffix of the
+// wildcard origin with subdomains in between
+func (w corsWildcardOrigin) match(origin string) bool {
+	if len(origin) <= len(w.prefix)+len(w.suffix) ||
+		!strings.HasPrefix(origin, w.prefix) ||
+		!strings.HasSuffix(origin, w.suffix) {
+		return false
+	}
+	subdomains := origin[len(w.prefix) : len(origin)-len(w.suffix)]
+	if strings.HasPrefix(subdomains, ".") || strings.HasSuffix(subdomains, ".") || strings.Contains(subdomains, "..") {
+		return false
+	}
+	return !strings.ContainsAny(subdomains, "/:@?#*")
+}
+
+// newCORSOriginCache returns a cache of the results of :allowOrigin which expire
+// after :ttl
+func newCORSOriginCache(allowOrigin func(string, *http.Request) bool, ttl time.Duration) *corsOriginCache {
+	return &corsOriginCache{
+		allowOrigin: allowOrigin,
+		ttl:         ttl,
+		entries:     map[string]corsOriginCacheEntry{},
+		now:         time.Now,
+	}
+}
+
+type corsOriginCache struct {
+	allowOrigin func(string, *http.Request) bool
+	ttl         time.Duration
+	mutex       sync.Mutex
+	entries     map[string]corsOriginCacheEntry
+	now         func() time.Time
+}
+
+type corsOriginCacheEntry struct {
+	allowed bool
+	expires time.Time
+}
+
+// allow returns the cached result for the :origin if it has not expired and calls
+// the underlying function with the :origin and the request :r otherwise
+func (c *corsOriginCache) allow(origin string, r *http.Request) bool {
+	c.mutex.Lock()
+	entry, ok := c.entries[origin]
+	c.mutex.Unlock()
+	now := c.now()
+	if ok && now.Before(entry.expires) {
+		return entry.allowed
+	}
+	allowed := c.allowOrigin(origin, r)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.entries) >= corsOriginCacheMaxEntries {
+		for cachedOrigin, cachedEntry := range c.entries {
+			if !now.Before(cachedEntry.expires) {
+				delete(c.entries, cachedOrigin)
+			}
+		}
+		if len(c.entries) >= corsOriginCacheMaxEntries {
+			c.entries = map[string]corsOriginCacheEntry{}
+		}
+	}
+	c.entries[origin] = corsOriginCacheEntry{allowed: allowed, expires: now.Add(c.ttl)}
+	return allowed
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CORSOriginTests struct {
+	suite.Suite
+}
+
+func TestCORSOrigin(t *testing.T) {
+	suite.Run(t, &CORSOriginTests{})
+}
+
+func (s CORSOriginTests) Test_newCORSOriginMatcher() {
+	matcher := newCORSOriginMatcher(
+		[]string{"http://localhost:3000", "https://*.Example.com", "https://*.preview.example.org:8443"},
+		[]string{`https://pr-[0-9]+\.example\.net`},
+	)
+	testCases := map[string]bool{
+		"":                                      false,
+		"http://localhost:3000":                 true,
+		"HTTP://LOCALHOST:3000":                 true,
+		"http://localhost:3001":                 false,
+		"https://app.example.com":               true,
+		"https://a.b.example.com":               true,
+		"https://example.com":                   false,
+		"https://.example.com":                  false,
+		"http://app.example.com":                false,
+		"https://evil.com/.example.com":         false,
+		"https://user@app.example.com":          false,
+		"https://app.example.com.evil.com":      false,
+		"https://a..example.com":                false,
+		"https://pr-1.preview.example.org:8443": true,
+		"https://pr-1.preview.example.org":      false,
+		"https://pr-12.example.net":             true,
+		"https://pr-12.example.net.evil.com":    false,
+		"https://pr-x.example.net":              false,
+	}
+	for origin, expected := range testCases {
+		s.Equal(expected, matcher.match(origin), "origin: %q", origin)
+	}
+	s.False(matcher.any)
+	s.True(newCORSOriginMatcher([]string{CORSAnyOrigin}, nil).match("https://anything.com"))
+	s.Panics(func() { newCORSOriginMatcher(nil, []string{"("}) })
+}
+
+func (s CORSOriginTests) Test_anyOrigin() {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	serve := func(allowCredentials bool) *httptest.ResponseRecorder {
+		withCORS := NewCORS(CORSConfiguration{
+			AllowCredentials: allowCredentials,
+			AllowMethods:     []string{http.MethodGet},
+			AllowOrigins:     []string{CORSAnyOrigin},
+		})
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set(CORSOrigin, "https://anything.com")
+		recorder := httptest.NewRecorder()
+		withCORS(next).ServeHTTP(recorder, request)
+		return recorder
+	}
+	s.Equal(CORSAnyOrigin, serve(false).Header().Get(CORSAccessControlAllowOrigin))
+	s.Equal("https://anything.com", serve(true).Header().Get(CORSAccessControlAllowOrigin),
+		"the origin should be echoed instead of * for credentialed requests")
+}
+
+func (s CORSOriginTests) Test_allowOriginFunc() {
+	calls := 0
+	withCORS := NewCORS(CORSConfiguration{
+		AllowMethods: []string{http.MethodGet},
+		AllowOrigins: []string{"https://static.example.com"},
+		AllowOriginFunc: func(origin string, r *http.Request) bool {
+			calls++
+			s.NotNil(r)
+			return origin == "https://tenant.example.com"
+		},
+	})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	getAllowOrigin := func(origin string) string {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set(CORSOrigin, origin)
+		recorder := httptest.NewRecorder()
+		withCORS(next).ServeHTTP(recorder, request)
+		return recorder.Header().Get(CORSAccessControlAllowOrigin)
+	}
+	s.Equal("https://static.example.com", getAllowOrigin("https://static.example.com"))
+	s.Equal(0, calls, "the function should not be called for statically allowed origins")
+	s.Equal("https://tenant.example.com", getAllowOrigin("https://tenant.example.com"))
+	s.Equal("", getAllowOrigin("https://other.example.com"))
+	s.Equal(2, calls)
+}
+
+func (s CORSOriginTests) Test_corsOriginCache() {
+	calls := 0
+	allowed := true
+	cache := newCORSOriginCache(func(origin string, r *http.Request) bool {
+		calls++
+		return allowed
+	}, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	s.True(cache.allow("https://tenant.example.com", request))
+	allowed = false
+	s.True(cache.allow("https://tenant.example.com", request), "results should be cached")
+	s.Equal(1, calls)
+	s.False(cache.allow("https://other.example.com", request), "results should be cached by origin")
+	s.Equal(2, calls)
+
+	now = now.Add(time.Minute)
+	s.False(cache.allow("https://tenant.example.com", request), "results should expire")
+	s.Equal(3, calls)
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/usvc/go-server/metrics"
+	"github.com/usvc/go-server/types"
+)
+
+const (
+	CORSRejectionOrigin = "origin"
+	CORSRejectionMethod = "method"
+	CORSRejectionHeader = "header"
+	// CORSRejectionPrivateNetwork is the reason for rejecting preflight requests to a
+	// private network when CORSConfiguration.AllowPrivateNetwork is not set
+	CORSRejectionPrivateNetwork = "private_network"
+
+	CORSRejectionsLabelReason = "reason"
+	CORSRejectionsSink        = "http.server.cors.rejections"
+)
+
+// newCORSRejections returns a recorder of the rejections of the CORS policies
+// configured by :conf, the metric is only registered if conf.Registerer is set
+func newCORSRejections(conf CORSConfiguration) *corsRejections {
+	rejections := &corsRejections{
+		log:  conf.Log,
+		sink: conf.Sink,
+		tags: metrics.Tags(metrics.MergeLabels(conf.ConstLabels)),
+	}
+	if conf.Registerer != nil {
+		rejections.counter = metrics.Register(conf.Registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "http_server_cors_rejections_total",
+			Help:        "Number of cross-origin requests rejected by the CORS policy, including those allowed in report-only mode",
+			ConstLabels: conf.ConstLabels,
+		}, []string{CORSRejectionsLabelReason})).(*prometheus.CounterVec)
+	}
+	return rejections
+}
+
+type corsRejections struct {
+	counter *prometheus.CounterVec
+	log     types.Logger
+	sink    metrics.Sink
+	tags    metrics.Tags
+}
+
+// observe records that the request :r was rejected for the :reason because of the
+// disallowed :value, logging it if the policy is in :reportOnly mode
+func (c *corsRejections) observe(r *http.Request, reason, value string, reportOnly bool) {
+	if c.counter != nil {
+		c.counter.WithLabelValues(reason).Inc()
+	}
+	if c.sink != nil {
+		c.sink.Count(CORSRejectionsSink, 1, metrics.MergeTags(c.tags, metrics.Tags{CORSRejectionsLabelReason: reason}))
+	}
+	if reportOnly && c.log != nil {
+		c.log(fmt.Sprintf(
+			"cors report-only: allowed %s request to '%s' from '%s' which would have been rejected reason=%s value=%s request_id=%s",
+			r.Method, r.URL.Path, r.Header.Get(CORSOrigin), reason, formatLog(value), formatInterface(r.Context().Value(RequestContextID)),
+		))
+	}
+}
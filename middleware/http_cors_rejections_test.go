@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/suite"
+)
+
+type CORSRejectionsTests struct {
+	suite.Suite
+}
+
+func TestCORSRejections(t *testing.T) {
+	suite.Run(t, &CORSRejectionsTests{})
+}
+
+func (s CORSRejectionsTests) Test_reportOnly() {
+	registry := prometheus.NewRegistry()
+	sink := &recordingSink{}
+	logs := []string{}
+	withCORS := NewCORS(CORSConfiguration{
+		AllowHeaders: []string{"X-Requested-With"},
+		AllowMethods: []string{http.MethodGet},
+		AllowOrigins: []string{"https://app.example.com"},
+		ReportOnly:   true,
+		Log: func(args ...interface{}) {
+			logs = append(logs, fmt.Sprint(args...))
+		},
+		Registerer:  registry,
+		ConstLabels: prometheus.Labels{"service": "expected-service"},
+		Sink:        sink,
+	})
+	handler := withCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(method string, header http.Header) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, "/path", nil)
+		request.Header = header
+		request = request.WithContext(context.WithValue(request.Context(), RequestContextID, "expected-id"))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	response := serve(http.MethodGet, http.Header{CORSOrigin: {"https://evil.example.com"}})
+	s.Equal(http.StatusOK, response.Code)
+	s.Equal("https://evil.example.com", response.Header().Get(CORSAccessControlAllowOrigin),
+		"rejected requests should be allowed in report-only mode")
+
+	response = serve(http.MethodOptions, http.Header{
+		CORSOrigin:                     {"https://app.example.com"},
+		CORSAccessControlRequestMethod: {http.MethodDelete},
+	})
+	s.Equal(http.StatusNoContent, response.Code)
+	s.Equal("GET", response.Header().Get(CORSAccessControlAllowMethods))
+
+	response = serve(http.MethodOptions, http.Header{
+		CORSOrigin:                      {"https://app.example.com"},
+		CORSAccessControlRequestMethod:  {http.MethodGet},
+		CORSAccessControlRequestHeaders: {"x-requested-with, authorization"},
+	})
+	s.Equal(http.StatusNoContent, response.Code)
+
+	response = serve(http.MethodOptions, http.Header{
+		CORSOrigin:                     {"https://app.example.com"},
+		CORSAccessControlRequestMethod: {http.MethodGet},
+	})
+	s.Equal(http.StatusNoContent, response.Code)
+
+	s.Equal([]string{
+		"cors report-only: allowed GET request to '/path' from 'https://evil.example.com' which would have been rejected reason=origin value=https://evil.example.com request_id=expected-id",
+		"cors report-only: allowed OPTIONS request to '/path' from 'https://app.example.com' which would have been rejected reason=method value=DELETE request_id=expected-id",
+		"cors report-only: allowed OPTIONS request to '/path' from 'https://app.example.com' which would have been rejected reason=header value=authorization request_id=expected-id",
+	}, logs, "allowed requests should not be logged")
+	expected := `
+# HELP http_server_cors_rejections_total Number of cross-origin requests rejected by the CORS policy, including those allowed in report-only mode
+# TYPE http_server_cors_rejections_total counter
+http_server_cors_rejections_total{reason="header",service="expected-service"} 1
+http_server_cors_rejections_total{reason="method",service="expected-service"} 1
+http_server_cors_rejections_total{reason="origin",service="expected-service"} 1
+`
+	s.Nil(testutil.GatherAndCompare(registry, strings.NewReader(expected), "http_server_cors_rejections_total"))
+	s.Equal([]string{
+		"count http.server.cors.rejections map[reason:origin service:expected-service]",
+		"count http.server.cors.rejections map[reason:method service:expected-service]",
+		"count http.server.cors.rejections map[reason:header service:expected-service]",
+	}, sink.measurements)
+}
+
+func (s CORSRejectionsTests) Test_enforced() {
+	registry := prometheus.NewRegistry()
+	logs := []string{}
+	withCORS := NewCORS(CORSConfiguration{
+		AllowMethods: []string{http.MethodGet},
+		AllowOrigins: []string{"https://app.example.com"},
+		Log: func(args ...interface{}) {
+			logs = append(logs, fmt.Sprint(args...))
+		},
+		Registerer: registry,
+		Routes: []CORSRoute{
+			{PathPrefix: "/public/", Policy: CORSConfiguration{ReportOnly: true}},
+		},
+	})
+	handler := withCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(path string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodOptions, path, nil)
+		request.Header.Set(CORSOrigin, "https://app.example.com")
+		request.Header.Set(CORSAccessControlRequestMethod, http.MethodGet)
+		request.Header.Set(CORSAccessControlRequestPrivateNetwork, "true")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	s.Equal(http.StatusBadRequest, serve("/").Code)
+	s.Empty(logs, "rejections should only be logged in report-only mode")
+	s.Equal(http.StatusNoContent, serve("/public/feed").Code,
+		"route policies should have their own report-only mode")
+	s.Len(logs, 1)
+	s.Contains(logs[0], "reason=origin")
+	expected := `
+# HELP http_server_cors_rejections_total Number of cross-origin requests rejected by the CORS policy, including those allowed in report-only mode
+# TYPE http_server_cors_rejections_total counter
+http_server_cors_rejections_total{reason="origin"} 1
+http_server_cors_rejections_total{reason="private_network"} 1
+`
+	s.Nil(testutil.GatherAndCompare(registry, strings.NewReader(expected), "http_server_cors_rejections_total"))
+}
@@ -59,40 +59,44 @@ func (s CORSTests) Test_e2e() {
 	s.Contains(response.Header, CORSAccessControlAllowCredentials)
 	s.Equal("true", response.Header.Get(CORSAccessControlAllowCredentials))
 	s.Contains(response.Header, CORSAccessControlAllowHeaders)
-	s.Equal(expectedAllowedHeaders[0], response.Header.Get(CORSAccessControlAllowHeaders))
-	s.Equal(expectedAllowedMethods[0], response.Header.Get(CORSAccessControlAllowMethods))
+	s.Equal(strings.Join(expectedAllowedHeaders, ", "), response.Header.Get(CORSAccessControlAllowHeaders))
+	s.Equal(strings.Join(expectedAllowedMethods, ", "), response.Header.Get(CORSAccessControlAllowMethods))
 	s.Contains(response.Header, CORSAccessControlAllowOrigin)
 	s.Equal(expectedAllowedOrigins[0], response.Header.Get(CORSAccessControlAllowOrigin))
 	s.Equal(expectedMaxAgeString, response.Header.Get(CORSAccessControlMaxAge))
+	s.NotContains(response.Header, CORSAccessControlExposeHeaders)
 	s.Equal(http.StatusNoContent, response.StatusCode)
 	s.Equal("", string(body))
 
-	// sad preflight request (origin)
+	// sad preflight requests (origin, headers and methods)
 
-	request, err = http.NewRequest(http.MethodOptions, server.URL, nil)
-	request.Header.Add(CORSOrigin, "http://unexpectedorigin.com")
-	request.Header.Add(CORSAccessControlRequestHeaders, expectedAllowedHeaders[0])
-	request.Header.Add(CORSAccessControlRequestMethod, expectedAllowedMethods[0])
-	s.Nil(err)
-	response, err = http.DefaultClient.Do(request)
-	s.Nil(err)
-	body, err = ioutil.ReadAll(response.Body)
-	s.Nil(err)
-	s.Contains(response.Header, CORSAccessControlAllowCredentials)
-	s.Equal("true", response.Header.Get(CORSAccessControlAllowCredentials))
-	s.Contains(response.Header, CORSAccessControlAllowHeaders)
-	s.Equal(expectedAllowedHeaders[0], response.Header.Get(CORSAccessControlAllowHeaders))
-	s.Equal(expectedAllowedMethods[0], response.Header.Get(CORSAccessControlAllowMethods))
-	s.NotContains(response.Header, CORSAccessControlAllowOrigin)
-	s.Equal(http.StatusBadRequest, response.StatusCode)
-	s.Equal("", string(body))
+	for _, requestHeaders := range []map[string]string{
+		{CORSOrigin: "http://unexpectedorigin.com", CORSAccessControlRequestHeaders: expectedAllowedHeaders[0], CORSAccessControlRequestMethod: expectedAllowedMethods[0]},
+		{CORSOrigin: expectedAllowedOrigins[0], CORSAccessControlRequestHeaders: "X-Unexpected-Header", CORSAccessControlRequestMethod: expectedAllowedMethods[0]},
+		{CORSOrigin: expectedAllowedOrigins[0], CORSAccessControlRequestHeaders: expectedAllowedHeaders[0], CORSAccessControlRequestMethod: http.MethodDelete},
+	} {
+		request, err = http.NewRequest(http.MethodOptions, server.URL, nil)
+		s.Nil(err)
+		for key, value := range requestHeaders {
+			request.Header.Add(key, value)
+		}
+		response, err = http.DefaultClient.Do(request)
+		s.Nil(err)
+		body, err = ioutil.ReadAll(response.Body)
+		s.Nil(err)
+		s.NotContains(response.Header, CORSAccessControlAllowCredentials)
+		s.NotContains(response.Header, CORSAccessControlAllowHeaders)
+		s.NotContains(response.Header, CORSAccessControlAllowMethods)
+		s.NotContains(response.Header, CORSAccessControlAllowOrigin)
+		s.NotContains(response.Header, CORSAccessControlMaxAge)
+		s.Equal(http.StatusBadRequest, response.StatusCode)
+		s.Equal("", string(body))
+	}
 
-	// sad preflight request (headers)
+	// actual request
 
-	request, err = http.NewRequest(http.MethodOptions, server.URL, nil)
+	request, err = http.NewRequest(http.MethodGet, server.URL, nil)
 	request.Header.Add(CORSOrigin, expectedAllowedOrigins[0])
-	request.Header.Add(CORSAccessControlRequestHeaders, "X-Unexpected-Header")
-	request.Header.Add(CORSAccessControlRequestMethod, expectedAllowedMethods[0])
 	s.Nil(err)
 	response, err = http.DefaultClient.Do(request)
 	s.Nil(err)
@@ -101,51 +105,413 @@ func (s CORSTests) Test_e2e() {
 	s.Contains(response.Header, CORSAccessControlAllowCredentials)
 	s.Equal("true", response.Header.Get(CORSAccessControlAllowCredentials))
 	s.NotContains(response.Header, CORSAccessControlAllowHeaders)
-	s.Contains(response.Header, CORSAccessControlAllowMethods)
-	s.Equal(expectedAllowedMethods[0], response.Header.Get(CORSAccessControlAllowMethods))
-	s.Contains(response.Header, CORSAccessControlAllowOrigin)
+	s.NotContains(response.Header, CORSAccessControlAllowMethods)
 	s.Equal(expectedAllowedOrigins[0], response.Header.Get(CORSAccessControlAllowOrigin))
-	s.Equal(http.StatusBadRequest, response.StatusCode)
-	s.Equal("", string(body))
+	s.Equal(strings.Join(expectedExposedHeaders, ", "), response.Header.Get(CORSAccessControlExposeHeaders))
+	s.Equal(http.StatusOK, response.StatusCode)
+	s.Equal(expectedBody, string(body))
+}
 
-	// sad preflight request (methods)
+// corsConformanceCase is a request to the CORS middleware and the exact response
+// headers and status it is expected to receive
+type corsConformanceCase struct {
+	method         string
+	requestHeader  http.Header
+	responseHeader http.Header
+	status         int
+}
 
-	request, err = http.NewRequest(http.MethodOptions, server.URL, nil)
-	request.Header.Add(CORSOrigin, expectedAllowedOrigins[0])
-	request.Header.Add(CORSAccessControlRequestHeaders, expectedAllowedHeaders[0])
-	request.Header.Add(CORSAccessControlRequestMethod, http.MethodDelete)
-	s.Nil(err)
-	response, err = http.DefaultClient.Do(request)
-	s.Nil(err)
-	body, err = ioutil.ReadAll(response.Body)
-	s.Nil(err)
-	s.Contains(response.Header, CORSAccessControlAllowCredentials)
-	s.Equal("true", response.Header.Get(CORSAccessControlAllowCredentials))
-	s.Contains(response.Header, CORSAccessControlAllowHeaders)
-	s.Equal(expectedAllowedHeaders[0], response.Header.Get(CORSAccessControlAllowHeaders))
-	s.NotContains(response.Header, CORSAccessControlAllowMethods)
-	s.Contains(response.Header, CORSAccessControlAllowOrigin)
-	s.Equal(expectedAllowedOrigins[0], response.Header.Get(CORSAccessControlAllowOrigin))
-	s.Equal(http.StatusBadRequest, response.StatusCode)
-	s.Equal("", string(body))
+// serveConformanceCases serves each of the :cases with a handler wrapped in the CORS
+// middleware configured with :config which sets a Vary header and responds with a 200
+func (s CORSTests) serveConformanceCases(config CORSConfiguration, cases map[string]corsConformanceCase) {
+	withCORS := NewCORS(config)
+	handler := withCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for name, testCase := range cases {
+		request := httptest.NewRequest(testCase.method, "/", nil)
+		request.Header = testCase.requestHeader
+		recorder := httptest.NewRecorder()
+		recorder.Header().Set(CORSVary, "Accept-Encoding")
+		handler.ServeHTTP(recorder, request)
+		s.Equal(testCase.status, recorder.Code, name)
+		s.Equal(testCase.responseHeader, recorder.Header(), name)
+	}
+}
 
-	// actual request
+func (s CORSTests) Test_conformance() {
+	s.serveConformanceCases(CORSConfiguration{
+		AllowCredentials: true,
+		AllowHeaders:     []string{"X-Requested-With", "Content-Type"},
+		AllowMethods:     []string{http.MethodGet, http.MethodPut, http.MethodDelete},
+		AllowOrigins:     []string{"https://app.example.com"},
+		ExposeHeaders:    []string{"X-Request-ID", "ETag"},
+		MaxAge:           90 * time.Second,
+	}, map[string]corsConformanceCase{
+		"non-cors request": {
+			method:        http.MethodGet,
+			requestHeader: http.Header{},
+			responseHeader: http.Header{
+				CORSVary: {"Accept-Encoding, Origin"},
+			},
+			status: http.StatusOK,
+		},
+		"options request without a requested method is not a preflight": {
+			method:        http.MethodOptions,
+			requestHeader: http.Header{CORSOrigin: {"https://app.example.com"}},
+			responseHeader: http.Header{
+				CORSVary:                          {"Accept-Encoding, Origin"},
+				CORSAccessControlAllowOrigin:      {"https://app.example.com"},
+				CORSAccessControlAllowCredentials: {"true"},
+				CORSAccessControlExposeHeaders:    {"X-Request-ID, ETag"},
+			},
+			status: http.StatusOK,
+		},
+		"actual request from an allowed origin": {
+			method:        http.MethodPut,
+			requestHeader: http.Header{CORSOrigin: {"https://app.example.com"}},
+			responseHeader: http.Header{
+				CORSVary:                          {"Accept-Encoding, Origin"},
+				CORSAccessControlAllowOrigin:      {"https://app.example.com"},
+				CORSAccessControlAllowCredentials: {"true"},
+				CORSAccessControlExposeHeaders:    {"X-Request-ID, ETag"},
+			},
+			status: http.StatusOK,
+		},
+		"actual request from a disallowed origin": {
+			method:        http.MethodGet,
+			requestHeader: http.Header{CORSOrigin: {"https://evil.example.com"}},
+			responseHeader: http.Header{
+				CORSVary: {"Accept-Encoding, Origin"},
+			},
+			status: http.StatusOK,
+		},
+		"preflight without requested headers": {
+			method: http.MethodOptions,
+			requestHeader: http.Header{
+				CORSOrigin:                     {"https://app.example.com"},
+				CORSAccessControlRequestMethod: {http.MethodDelete},
+			},
+			responseHeader: http.Header{
+				CORSVary:                          {"Accept-Encoding, Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network"},
+				CORSAccessControlAllowOrigin:      {"https://app.example.com"},
+				CORSAccessControlAllowCredentials: {"true"},
+				CORSAccessControlAllowMethods:     {"GET, PUT, DELETE"},
+				CORSAccessControlAllowHeaders:     {"X-Requested-With, Content-Type"},
+				CORSAccessControlMaxAge:           {"90"},
+			},
+			status: http.StatusNoContent,
+		},
+		"preflight with requested headers in any case and format": {
+			method: http.MethodOptions,
+			requestHeader: http.Header{
+				CORSOrigin:                      {"https://app.example.com"},
+				CORSAccessControlRequestMethod:  {http.MethodPut},
+				CORSAccessControlRequestHeaders: {"content-type,x-requested-with", " , X-REQUESTED-WITH "},
+			},
+			responseHeader: http.Header{
+				CORSVary:                          {"Accept-Encoding, Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network"},
+				CORSAccessControlAllowOrigin:      {"https://app.example.com"},
+				CORSAccessControlAllowCredentials: {"true"},
+				CORSAccessControlAllowMethods:     {"GET, PUT, DELETE"},
+				CORSAccessControlAllowHeaders:     {"X-Requested-With, Content-Type"},
+				CORSAccessControlMaxAge:           {"90"},
+			},
+			status: http.StatusNoContent,
+		},
+		"preflight with a cors-safelisted method which is not allowed explicitly": {
+			method: http.MethodOptions,
+			requestHeader: http.Header{
+				CORSOrigin:                      {"https://app.example.com"},
+				CORSAccessControlRequestMethod:  {http.MethodPost},
+				CORSAccessControlRequestHeaders: {"x-requested-with"},
+			},
+			responseHeader: http.Header{
+				CORSVary:                          {"Accept-Encoding, Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network"},
+				CORSAccessControlAllowOrigin:      {"https://app.example.com"},
+				CORSAccessControlAllowCredentials: {"true"},
+				CORSAccessControlAllowMethods:     {"GET, PUT, DELETE"},
+				CORSAccessControlAllowHeaders:     {"X-Requested-With, Content-Type"},
+				CORSAccessControlMaxAge:           {"90"},
+			},
+			status: http.StatusNoContent,
+		},
+		"preflight from a disallowed origin": {
+			method: http.MethodOptions,
+			requestHeader: http.Header{
+				CORSOrigin:                     {"https://evil.example.com"},
+				CORSAccessControlRequestMethod: {http.MethodGet},
+			},
+			responseHeader: http.Header{
+				CORSVary: {"Accept-Encoding, Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network"},
+			},
+			status: http.StatusBadRequest,
+		},
+		"preflight with a disallowed method": {
+			method: http.MethodOptions,
+			requestHeader: http.Header{
+				CORSOrigin:                     {"https://app.example.com"},
+				CORSAccessControlRequestMethod: {"delete"},
+			},
+			responseHeader: http.Header{
+				CORSVary: {"Accept-Encoding, Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network"},
+			},
+			status: http.StatusBadRequest,
+		},
+		"preflight with a disallowed header": {
+			method: http.MethodOptions,
+			requestHeader: http.Header{
+				CORSOrigin:                      {"https://app.example.com"},
+				CORSAccessControlRequestMethod:  {http.MethodGet},
+				CORSAccessControlRequestHeaders: {"x-requested-with, authorization"},
+			},
+			responseHeader: http.Header{
+				CORSVary: {"Accept-Encoding, Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network"},
+			},
+			status: http.StatusBadRequest,
+		},
+	})
+}
 
-	request, err = http.NewRequest(http.MethodGet, server.URL, nil)
-	request.Header.Add(CORSAccessControlRequestHeaders, expectedAllowedHeaders[0])
-	request.Header.Add(CORSAccessControlRequestHeaders, expectedAllowedHeaders[1])
-	request.Header.Add(CORSOrigin, expectedAllowedOrigins[0])
-	s.Nil(err)
-	response, err = http.DefaultClient.Do(request)
-	s.Nil(err)
-	body, err = ioutil.ReadAll(response.Body)
-	s.Nil(err)
-	s.Contains(response.Header, CORSAccessControlAllowCredentials)
-	s.Equal("true", response.Header.Get(CORSAccessControlAllowCredentials))
-	s.Equal(expectedAllowedHeaders[0], response.Header.Get(CORSAccessControlAllowHeaders))
-	s.Equal(http.MethodGet, response.Header.Get(CORSAccessControlAllowMethods))
-	s.Equal(expectedAllowedOrigins[0], response.Header.Get(CORSAccessControlAllowOrigin))
-	s.Equal(strings.Join(expectedExposedHeaders, ","), response.Header.Get(CORSAccessControlExposeHeaders))
-	s.Equal(http.StatusOK, response.StatusCode)
-	s.Equal(expectedBody, string(body))
+func (s CORSTests) Test_conformanceWildcards() {
+	s.serveConformanceCases(CORSConfiguration{
+		AllowHeaders: []string{"*"},
+		AllowMethods: []string{"*"},
+		AllowOrigins: []string{CORSAnyOrigin},
+	}, map[string]corsConformanceCase{
+		"actual request does not vary by origin": {
+			method:        http.MethodGet,
+			requestHeader: http.Header{CORSOrigin: {"https://anything.example.com"}},
+			responseHeader: http.Header{
+				CORSVary:                     {"Accept-Encoding"},
+				CORSAccessControlAllowOrigin: {"*"},
+			},
+			status: http.StatusOK,
+		},
+		"preflight echoes the requested method and headers": {
+			method: http.MethodOptions,
+			requestHeader: http.Header{
+				CORSOrigin:                      {"https://anything.example.com"},
+				CORSAccessControlRequestMethod:  {"PURGE"},
+				CORSAccessControlRequestHeaders: {"authorization,x-custom"},
+			},
+			responseHeader: http.Header{
+				CORSVary:                      {"Accept-Encoding, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network"},
+				CORSAccessControlAllowOrigin:  {"*"},
+				CORSAccessControlAllowMethods: {"PURGE"},
+				CORSAccessControlAllowHeaders: {"authorization, x-custom"},
+			},
+			status: http.StatusNoContent,
+		},
+	})
+}
+
+func (s CORSTests) Test_passthrough() {
+	s.serveConformanceCases(CORSConfiguration{
+		AllowMethods:      []string{http.MethodGet},
+		AllowOrigins:      []string{"https://app.example.com"},
+		EnablePassthrough: true,
+	}, map[string]corsConformanceCase{
+		"allowed preflight reaches the handler": {
+			method: http.MethodOptions,
+			requestHeader: http.Header{
+				CORSOrigin:                     {"https://app.example.com"},
+				CORSAccessControlRequestMethod: {http.MethodGet},
+			},
+			responseHeader: http.Header{
+				CORSVary:                      {"Accept-Encoding, Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network"},
+				CORSAccessControlAllowOrigin:  {"https://app.example.com"},
+				CORSAccessControlAllowMethods: {"GET"},
+			},
+			status: http.StatusOK,
+		},
+		"rejected preflight reaches the handler without cors headers": {
+			method: http.MethodOptions,
+			requestHeader: http.Header{
+				CORSOrigin:                     {"https://app.example.com"},
+				CORSAccessControlRequestMethod: {http.MethodPut},
+			},
+			responseHeader: http.Header{
+				CORSVary: {"Accept-Encoding, Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network"},
+			},
+			status: http.StatusOK,
+		},
+	})
+}
+
+func (s CORSTests) Test_privateNetwork() {
+	privateNetworkPreflight := http.Header{
+		CORSOrigin:                             {"https://app.example.com"},
+		CORSAccessControlRequestMethod:         {http.MethodGet},
+		CORSAccessControlRequestPrivateNetwork: {"true"},
+	}
+	vary := []string{"Accept-Encoding, Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network"}
+	config := CORSConfiguration{
+		AllowMethods: []string{http.MethodGet},
+		AllowOrigins: []string{"https://app.example.com"},
+	}
+	s.serveConformanceCases(config, map[string]corsConformanceCase{
+		"private network preflight is rejected unless allowed": {
+			method:         http.MethodOptions,
+			requestHeader:  privateNetworkPreflight,
+			responseHeader: http.Header{CORSVary: vary},
+			status:         http.StatusBadRequest,
+		},
+	})
+
+	config.AllowPrivateNetwork = true
+	s.serveConformanceCases(config, map[string]corsConformanceCase{
+		"private network preflight": {
+			method:        http.MethodOptions,
+			requestHeader: privateNetworkPreflight,
+			responseHeader: http.Header{
+				CORSVary:                             vary,
+				CORSAccessControlAllowOrigin:         {"https://app.example.com"},
+				CORSAccessControlAllowMethods:        {"GET"},
+				CORSAccessControlAllowPrivateNetwork: {"true"},
+			},
+			status: http.StatusNoContent,
+		},
+		"preflight which is not for a private network": {
+			method: http.MethodOptions,
+			requestHeader: http.Header{
+				CORSOrigin:                     {"https://app.example.com"},
+				CORSAccessControlRequestMethod: {http.MethodGet},
+			},
+			responseHeader: http.Header{
+				CORSVary:                      vary,
+				CORSAccessControlAllowOrigin:  {"https://app.example.com"},
+				CORSAccessControlAllowMethods: {"GET"},
+			},
+			status: http.StatusNoContent,
+		},
+		"private network preflight from a disallowed origin": {
+			method: http.MethodOptions,
+			requestHeader: http.Header{
+				CORSOrigin:                             {"https://evil.example.com"},
+				CORSAccessControlRequestMethod:         {http.MethodGet},
+				CORSAccessControlRequestPrivateNetwork: {"true"},
+			},
+			responseHeader: http.Header{CORSVary: vary},
+			status:         http.StatusBadRequest,
+		},
+	})
+
+	config.EnablePassthrough = true
+	s.serveConformanceCases(config, map[string]corsConformanceCase{
+		"private network preflight reaches the handler when passed through": {
+			method:        http.MethodOptions,
+			requestHeader: privateNetworkPreflight,
+			responseHeader: http.Header{
+				CORSVary:                             vary,
+				CORSAccessControlAllowOrigin:         {"https://app.example.com"},
+				CORSAccessControlAllowMethods:        {"GET"},
+				CORSAccessControlAllowPrivateNetwork: {"true"},
+			},
+			status: http.StatusOK,
+		},
+	})
+}
+
+func (s CORSTests) Test_routes() {
+	publicPolicy := CORSConfiguration{
+		AllowMethods: []string{http.MethodGet},
+		AllowOrigins: []string{CORSAnyOrigin},
+	}
+	adminPolicy := CORSConfiguration{
+		AllowCredentials: true,
+		AllowHeaders:     []string{"X-CSRF-Token"},
+		AllowMethods:     []string{http.MethodGet, http.MethodDelete},
+		AllowOrigins:     []string{"https://admin.example.com"},
+	}
+	withCORS := NewCORS(CORSConfiguration{
+		AllowMethods: []string{http.MethodGet},
+		AllowOrigins: []string{"https://app.example.com"},
+		Routes: []CORSRoute{
+			{PathPrefix: "/public/", Policy: publicPolicy},
+			{PathPrefix: "/static", Policy: publicPolicy},
+			{Route: "/admin/users/:id", Policy: adminPolicy},
+			{Route: "/admin/*", Policy: CORSConfiguration{AllowOrigins: []string{"https://ops.example.com"}}},
+		},
+		ExcludePaths: []string{"/healthz", "/metrics/"},
+	})
+	handler := withCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	getAllowOrigin := func(path, origin string) string {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.Header.Set(CORSOrigin, origin)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Header().Get(CORSAccessControlAllowOrigin)
+	}
+	testCases := []struct {
+		path     string
+		origin   string
+		expected string
+	}{
+		{"/", "https://app.example.com", "https://app.example.com"},
+		{"/", "https://admin.example.com", ""},
+		{"/public/feed", "https://anything.example.com", CORSAnyOrigin},
+		{"/public", "https://anything.example.com", CORSAnyOrigin},
+		{"/publications", "https://anything.example.com", ""},
+		{"/static/app.js", "https://anything.example.com", CORSAnyOrigin},
+		{"/staticfiles", "https://anything.example.com", ""},
+		{"/admin/users/1", "https://admin.example.com", "https://admin.example.com"},
+		{"/admin/users/1", "https://app.example.com", ""},
+		{"/admin/users", "https://ops.example.com", "https://ops.example.com"},
+		{"/admin/users/1/roles", "https://ops.example.com", "https://ops.example.com"},
+		{"/healthz", "https://app.example.com", ""},
+		{"/healthz/database", "https://app.example.com", ""},
+		{"/healthzz", "https://app.example.com", "https://app.example.com"},
+		{"/metrics", "https://app.example.com", ""},
+	}
+	for _, testCase := range testCases {
+		s.Equal(testCase.expected, getAllowOrigin(testCase.path, testCase.origin), "%s from %s", testCase.path, testCase.origin)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	request.Header.Set(CORSOrigin, "https://app.example.com")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	s.NotContains(recorder.Header(), CORSVary, "excluded paths should not be handled at all")
+}
+
+func (s CORSTests) Test_routesResolved() {
+	withCORS := NewCORS(CORSConfiguration{
+		AllowOrigins: []string{"https://app.example.com"},
+		Routes: []CORSRoute{
+			{Route: "/items/{id}", Policy: CORSConfiguration{AllowOrigins: []string{"https://items.example.com"}}},
+		},
+	})
+	withRoute := NewRouteResolver(RouteResolverConfiguration{
+		Normalizer: func(r *http.Request) string { return "/items/{id}" },
+	})
+	handler := withRoute(withCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	request := httptest.NewRequest(http.MethodGet, "/ITEMS/1?x=y", nil)
+	request.Header.Set(CORSOrigin, "https://items.example.com")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	s.Equal("https://items.example.com", recorder.Header().Get(CORSAccessControlAllowOrigin),
+		"routes resolved by the route resolver should be matched")
+}
+
+func (s CORSTests) Test_addVary() {
+	header := http.Header{}
+	addVary(header, CORSOrigin)
+	s.Equal([]string{"Origin"}, header.Values(CORSVary))
+	addVary(header, CORSOrigin, CORSAccessControlRequestMethod)
+	s.Equal([]string{"Origin, Access-Control-Request-Method"}, header.Values(CORSVary))
+
+	header = http.Header{CORSVary: {"accept-encoding, origin", "Accept"}}
+	addVary(header, CORSOrigin)
+	s.Equal([]string{"Accept-Encoding, Origin, Accept"}, header.Values(CORSVary))
+
+	header = http.Header{CORSVary: {"*"}}
+	addVary(header, CORSOrigin)
+	s.Equal([]string{"*"}, header.Values(CORSVary), "a wildcard should not be merged")
+}
+
+func (s CORSTests) Test_parseCORSHeaderList() {
+	s.Equal([]string{}, parseCORSHeaderList(nil))
+	s.Equal([]string{}, parseCORSHeaderList([]string{""}))
+	s.Equal([]string{"x-a", "x-b", "x-c"}, parseCORSHeaderList([]string{" X-A,,x-b ", "X-C"}))
 }
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/usvc/go-server/types"
+)
+
+const (
+	DefaultPasswordRealm     = "restricted"
+	PasswordAuthorization    = "Authorization"
+	PasswordWWWAuthenticate  = "WWW-Authenticate"
+	PasswordSchemeBasic      = "Basic"
+	PasswordSchemeBearer     = "Bearer"
+	PasswordResponseRejected = `"unauthorized"`
+)
+
+type PasswordConfiguration struct {
+	// Password is the secret which requests have to present either as a bearer
+	// token or as the password of a basic authentication header (the username is
+	// not checked). All requests are rejected if this is empty
+	Password string
+	// Realm is the realm indicated in the WWW-Authenticate response header
+	// when a request is rejected, defaults to DefaultPasswordRealm
+	Realm string
+	// Log receives a message for every rejected request, logging is disabled if
+	// this is nil
+	Log types.Logger
+}
+
+// NewPassword returns a middleware that rejects requests which do not present
+// the configured password. Passwords are compared in constant time using their
+// SHA-256 digests so that the length of the configured password is not revealed
+func NewPassword(config interface{}) Middleware {
+	conf := config.(PasswordConfiguration)
+	realm := conf.Realm
+	if len(realm) == 0 {
+		realm = DefaultPasswordRealm
+	}
+	password := sha256.Sum256([]byte(conf.Password))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			presented, err := getPresentedPassword(r)
+			if err == nil && len(conf.Password) == 0 {
+				err = fmt.Errorf("no password has been configured")
+			} else if err == nil && !isPassword(presented, password) {
+				err = fmt.Errorf("invalid password")
+			}
+			if err != nil {
+				if conf.Log != nil {
+					conf.Log(fmt.Sprintf("rejected request to '%s' from '%s': %s", r.URL.Path, r.RemoteAddr, err))
+				}
+				w.Header().Set(PasswordWWWAuthenticate, fmt.Sprintf("%s realm=%q", PasswordSchemeBasic, realm))
+				w.Header().Add(PasswordWWWAuthenticate, fmt.Sprintf("%s realm=%q", PasswordSchemeBearer, realm))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(PasswordResponseRejected))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isPassword returns true if the :presented password has the :expected SHA-256
+// digest, the digests are compared in constant time
+func isPassword(presented []byte, expected [sha256.Size]byte) bool {
+	digest := sha256.Sum256(presented)
+	return subtle.ConstantTimeCompare(digest[:], expected[:]) == 1
+}
+
+// getPresentedPassword extracts the password from the Authorization header of
+// the request :r
+func getPresentedPassword(r *http.Request) ([]byte, error) {
+	authorization := r.Header.Get(PasswordAuthorization)
+	if len(authorization) == 0 {
+		return nil, fmt.Errorf("missing credentials")
+	}
+	parts := strings.SplitN(authorization, " ", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed credentials")
+	}
+	scheme, credentials := parts[0], strings.TrimSpace(parts[1])
+	switch {
+	case strings.EqualFold(scheme, PasswordSchemeBearer):
+		return []byte(credentials), nil
+	case strings.EqualFold(scheme, PasswordSchemeBasic):
+		decoded, err := base64.StdEncoding.DecodeString(credentials)
+		if err != nil {
+			return nil, fmt.Errorf("malformed basic credentials")
+		}
+		userPassword := strings.SplitN(string(decoded), ":", 2)
+		if len(userPassword) != 2 {
+			return nil, fmt.Errorf("malformed basic credentials")
+		}
+		return []byte(userPassword[1]), nil
+	}
+	return nil, fmt.Errorf("unsupported authorization scheme '%s'", scheme)
+}
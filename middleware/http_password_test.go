@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type PasswordTests struct {
+	suite.Suite
+}
+
+func TestPassword(t *testing.T) {
+	suite.Run(t, &PasswordTests{})
+}
+
+func (s PasswordTests) Test_e2e() {
+	expectedBody := "testing password"
+	expectedPassword := "s3cr3t"
+	var output bytes.Buffer
+	c := PasswordConfiguration{
+		Password: expectedPassword,
+		Log: func(args ...interface{}) {
+			fmt.Fprint(&output, args...)
+		},
+	}
+	withPassword := NewPassword(c)
+	handler := http.NewServeMux()
+	handler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, expectedBody)
+	})
+	server := httptest.NewServer(withPassword(handler))
+	defer server.Close()
+
+	// bearer token
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	s.Nil(err)
+	request.Header.Set(PasswordAuthorization, "Bearer "+expectedPassword)
+	response, err := http.DefaultClient.Do(request)
+	s.Nil(err)
+	body, err := ioutil.ReadAll(response.Body)
+	s.Nil(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+	s.Equal(expectedBody, string(body))
+
+	// basic authentication
+	request, err = http.NewRequest(http.MethodGet, server.URL, nil)
+	s.Nil(err)
+	request.SetBasicAuth("anyone", expectedPassword)
+	response, err = http.DefaultClient.Do(request)
+	s.Nil(err)
+	body, err = ioutil.ReadAll(response.Body)
+	s.Nil(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+	s.Equal(expectedBody, string(body))
+	s.Empty(output.String())
+
+	// wrong password
+	request, err = http.NewRequest(http.MethodGet, server.URL+"/wrong", nil)
+	s.Nil(err)
+	request.SetBasicAuth("anyone", "wrong")
+	response, err = http.DefaultClient.Do(request)
+	s.Nil(err)
+	body, err = ioutil.ReadAll(response.Body)
+	s.Nil(err)
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+	s.Equal(PasswordResponseRejected, string(body))
+	s.Len(response.Header.Values(PasswordWWWAuthenticate), 2)
+	s.Contains(output.String(), "rejected request to '/wrong'")
+	s.Contains(output.String(), "invalid password")
+
+	// missing credentials
+	output.Reset()
+	request, err = http.NewRequest(http.MethodGet, server.URL, nil)
+	s.Nil(err)
+	response, err = http.DefaultClient.Do(request)
+	s.Nil(err)
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+	s.Contains(output.String(), "missing credentials")
+
+	// unsupported scheme
+	output.Reset()
+	request, err = http.NewRequest(http.MethodGet, server.URL, nil)
+	s.Nil(err)
+	request.Header.Set(PasswordAuthorization, "Digest "+expectedPassword)
+	response, err = http.DefaultClient.Do(request)
+	s.Nil(err)
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+	s.Contains(output.String(), "unsupported authorization scheme 'Digest'")
+}
+
+func (s PasswordTests) Test_emptyPassword() {
+	withPassword := NewPassword(PasswordConfiguration{})
+	handler := http.NewServeMux()
+	handler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(withPassword(handler))
+	defer server.Close()
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	s.Nil(err)
+	request.Header.Set(PasswordAuthorization, "Bearer ")
+	response, err := http.DefaultClient.Do(request)
+	s.Nil(err)
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+}
+
+func (s PasswordTests) Test_isPassword() {
+	expected := sha256.Sum256([]byte("expected-password"))
+	s.True(isPassword([]byte("expected-password"), expected))
+	s.False(isPassword([]byte("expected-passwor"), expected))
+	s.False(isPassword([]byte("expected-password-longer"), expected))
+	s.False(isPassword(nil, expected))
+}
@@ -21,7 +21,7 @@ func NewRequestLogger(config interface{}) Middleware {
 			next.ServeHTTP(responseWriterInstance, r)
 			requestDuration := time.Now().Sub(requestStart)
 
-			message := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %v %v \"%s\" \"%s\" rt=%v id=%s",
+			message := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %v %v \"%s\" \"%s\" rt=%v id=%s route=%s",
 				formatLog(r.RemoteAddr),
 				formatLog(r.URL.User.Username()),
 				formatLog(time.Now().UTC().Format("2/Jan/2006:15:04:05 -0700")),
@@ -34,6 +34,7 @@ func NewRequestLogger(config interface{}) Middleware {
 				formatLog(r.UserAgent()),
 				float64(float64(requestDuration.Microseconds())/1000),
 				formatInterface(r.Context().Value(RequestContextID)),
+				formatInterface(r.Context().Value(RequestContextRoute)),
 			)
 			log(message)
 		})
@@ -64,6 +64,8 @@ func (s RequestLoggerTest) Test_e2e() {
 		"the request latency should be logged")
 	s.Regexp(`id=-`, logEntry,
 		"the request id should be logged if its available")
+	s.Regexp(`route=-`, logEntry,
+		"the request route should be logged if its available")
 }
 
 func (s RequestLoggerTest) Test_formatInterface() {
@@ -0,0 +1,276 @@
+package middleware
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/usvc/go-server/metrics"
+)
+
+const (
+	DefaultRequestMetricsLabelMethod = "method"
+	DefaultRequestMetricsLabelStatus = "status"
+	DefaultRequestMetricsLabelRoute  = "route"
+	RequestMetricsExemplarRequestID  = "request_id"
+	RequestMetricsExemplarTraceID    = "trace_id"
+	RequestMetricsTraceParent        = "traceparent"
+	RequestMetricsSinkRequests       = "http.server.requests"
+	RequestMetricsSinkDuration       = "http.server.request.duration"
+	RequestMetricsSinkRequestSize    = "http.server.request.size"
+	RequestMetricsSinkResponseSize   = "http.server.response.size"
+	RequestMetricsSinkInFlight       = "http.server.requests.in_flight"
+	// MethodOther is the method label of requests which do not use a standard method
+	MethodOther = "other"
+)
+
+var (
+	// DefaultRequestMetricsSizeBuckets are the buckets used for request and response
+	// sizes in bytes, from 100 bytes to 10 megabytes
+	DefaultRequestMetricsSizeBuckets = prometheus.ExponentialBuckets(100, 10, 6)
+)
+
+type RequestMetricsConfiguration struct {
+	// Registerer is used to register the collectors, defaults to
+	// prometheus.DefaultRegisterer
+	Registerer prometheus.Registerer
+	// ConstLabels are applied to all of the metrics
+	ConstLabels prometheus.Labels
+	// DurationBuckets are the buckets of the request duration histogram in
+	// seconds, defaults to prometheus.DefBuckets
+	DurationBuckets []float64
+	// SizeBuckets are the buckets of the request and response size histograms in
+	// bytes, defaults to DefaultRequestMetricsSizeBuckets
+	SizeBuckets []float64
+	// LabelNames overrides the names of the labels applied to the metrics
+	LabelNames RequestMetricsLabelNames
+	// Route returns the route of the request used in the route label. To keep
+	// the number of series bounded, this should return a template rather than
+	// the request path. Defaults to the route resolved by NewRouteResolver and
+	// requests without a route are labelled with RouteOther
+	Route func(*http.Request) string
+	// Exemplar returns the labels of the exemplar attached to the request count
+	// and duration of a request. Defaults to the trace ID from the W3C traceparent
+	// header if the request is traced and the request ID set by
+	// NewRequestIdentifier otherwise. No exemplar is attached if this returns no
+	// labels or if the labels exceed prometheus.ExemplarMaxRunes. Exemplars are only
+	// served in the OpenMetrics format
+	Exemplar func(*http.Request) prometheus.Labels
+	// Sink also receives the measurements if it is set, tagged with the same labels
+	// and const labels as the Prometheus metrics
+	Sink metrics.Sink
+}
+
+type RequestMetricsLabelNames struct {
+	// Method defaults to DefaultRequestMetricsLabelMethod
+	Method string
+	// Status is the label for the status class (eg. 2xx), defaults to
+	// DefaultRequestMetricsLabelStatus
+	Status string
+	// Route defaults to DefaultRequestMetricsLabelRoute
+	Route string
+}
+
+// NewRequestMetrics returns a middleware that records the rate, errors and duration
+// of requests as well as their request and response sizes and the number of requests
+// in flight
+func NewRequestMetrics(config interface{}) Middleware {
+	conf := config.(RequestMetricsConfiguration)
+	registerer := conf.Registerer
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	durationBuckets := conf.DurationBuckets
+	if len(durationBuckets) == 0 {
+		durationBuckets = prometheus.DefBuckets
+	}
+	sizeBuckets := conf.SizeBuckets
+	if len(sizeBuckets) == 0 {
+		sizeBuckets = DefaultRequestMetricsSizeBuckets
+	}
+	getExemplar := conf.Exemplar
+	if getExemplar == nil {
+		getExemplar = getRequestExemplar
+	}
+	labels := []string{
+		getLabelName(conf.LabelNames.Method, DefaultRequestMetricsLabelMethod),
+		getLabelName(conf.LabelNames.Status, DefaultRequestMetricsLabelStatus),
+		getLabelName(conf.LabelNames.Route, DefaultRequestMetricsLabelRoute),
+	}
+	requests := metrics.Register(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "http_server_requests_total",
+		Help:        "Number of HTTP requests handled",
+		ConstLabels: conf.ConstLabels,
+	}, labels)).(*prometheus.CounterVec)
+	duration := metrics.Register(registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "http_server_request_duration_seconds",
+		Help:        "Duration of HTTP requests in seconds",
+		Buckets:     durationBuckets,
+		ConstLabels: conf.ConstLabels,
+	}, labels)).(*prometheus.HistogramVec)
+	requestSize := metrics.Register(registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "http_server_request_size_bytes",
+		Help:        "Size of HTTP request bodies in bytes",
+		Buckets:     sizeBuckets,
+		ConstLabels: conf.ConstLabels,
+	}, labels)).(*prometheus.HistogramVec)
+	responseSize := metrics.Register(registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "http_server_response_size_bytes",
+		Help:        "Size of HTTP response bodies in bytes",
+		Buckets:     sizeBuckets,
+		ConstLabels: conf.ConstLabels,
+	}, labels)).(*prometheus.HistogramVec)
+	inFlight := metrics.Register(registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "http_server_requests_in_flight",
+		Help:        "Number of HTTP requests being handled",
+		ConstLabels: conf.ConstLabels,
+	})).(prometheus.Gauge)
+	inFlightCount := int64(0)
+	observeInFlight := func(delta int64) {
+		inFlight.Add(float64(delta))
+		if conf.Sink != nil {
+			conf.Sink.Gauge(RequestMetricsSinkInFlight, float64(atomic.AddInt64(&inFlightCount, delta)), metrics.MergeTags(metrics.Tags(conf.ConstLabels)))
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestStart := time.Now()
+			observeInFlight(1)
+			defer observeInFlight(-1)
+			body := &countingReadCloser{ReadCloser: r.Body}
+			if r.Body != nil {
+				r.Body = body
+			}
+			responseWriterInstance := useResponseWriter(w)
+			next.ServeHTTP(responseWriterInstance, r)
+			elapsed := time.Since(requestStart)
+			requestBytes := body.count
+			if r.ContentLength > requestBytes {
+				requestBytes = r.ContentLength
+			}
+			route := GetRequestRoute(r)
+			if conf.Route != nil {
+				route = conf.Route(r)
+			}
+			if len(route) == 0 {
+				route = RouteOther
+			}
+			labelValues := []string{getMethod(r.Method), getStatusClass(responseWriterInstance.GetStatusCode()), route}
+			exemplar := getExemplar(r)
+			if getExemplarRunes(exemplar) > prometheus.ExemplarMaxRunes {
+				exemplar = nil
+			}
+			requestCount := requests.WithLabelValues(labelValues...)
+			if adder, ok := requestCount.(prometheus.ExemplarAdder); ok && len(exemplar) > 0 {
+				adder.AddWithExemplar(1, exemplar)
+			} else {
+				requestCount.Inc()
+			}
+			requestDuration := duration.WithLabelValues(labelValues...)
+			if observer, ok := requestDuration.(prometheus.ExemplarObserver); ok && len(exemplar) > 0 {
+				observer.ObserveWithExemplar(elapsed.Seconds(), exemplar)
+			} else {
+				requestDuration.Observe(elapsed.Seconds())
+			}
+			requestSize.WithLabelValues(labelValues...).Observe(float64(requestBytes))
+			responseSize.WithLabelValues(labelValues...).Observe(float64(responseWriterInstance.GetContentLength()))
+			if conf.Sink != nil {
+				tags := metrics.MergeTags(metrics.Tags(conf.ConstLabels))
+				for index, label := range labels {
+					tags[label] = labelValues[index]
+				}
+				conf.Sink.Count(RequestMetricsSinkRequests, 1, tags)
+				conf.Sink.Timing(RequestMetricsSinkDuration, elapsed, tags)
+				conf.Sink.Histogram(RequestMetricsSinkRequestSize, float64(requestBytes), tags)
+				conf.Sink.Histogram(RequestMetricsSinkResponseSize, float64(responseWriterInstance.GetContentLength()), tags)
+			}
+		})
+	}
+}
+
+// getLabelName returns :configured if it is set or :defaultName otherwise
+func getLabelName(configured, defaultName string) string {
+	if len(configured) == 0 {
+		return defaultName
+	}
+	return configured
+}
+
+// getRequestExemplar returns the exemplar labels of the request :r. The trace ID
+// and request ID do not fit within prometheus.ExemplarMaxRunes together, so the
+// trace ID is used if the request is traced and the request ID is used otherwise
+func getRequestExemplar(r *http.Request) prometheus.Labels {
+	exemplar := prometheus.Labels{}
+	if traceID := getTraceID(r); len(traceID) > 0 {
+		exemplar[RequestMetricsExemplarTraceID] = traceID
+	}
+	if id, ok := r.Context().Value(RequestContextID).(string); ok && len(id) > 0 {
+		exemplar[RequestMetricsExemplarRequestID] = id
+		if getExemplarRunes(exemplar) > prometheus.ExemplarMaxRunes {
+			delete(exemplar, RequestMetricsExemplarRequestID)
+		}
+	}
+	return exemplar
+}
+
+// getExemplarRunes returns the length of the names and values of the :exemplar
+func getExemplarRunes(exemplar prometheus.Labels) int {
+	runes := 0
+	for name, value := range exemplar {
+		runes += utf8.RuneCountInString(name) + utf8.RuneCountInString(value)
+	}
+	return runes
+}
+
+// getTraceID returns the trace ID from the W3C traceparent header of the request :r
+// or an empty string if the header is missing or invalid
+// ref: https://www.w3.org/TR/trace-context/#traceparent-header
+func getTraceID(r *http.Request) string {
+	fields := strings.Split(r.Header.Get(RequestMetricsTraceParent), "-")
+	if len(fields) < 4 || len(fields[1]) != 32 || fields[1] == strings.Repeat("0", 32) {
+		return ""
+	}
+	if _, err := hex.DecodeString(fields[1]); err != nil {
+		return ""
+	}
+	return fields[1]
+}
+
+// getMethod returns the :method if it is one of the methods defined by RFC 7231 and
+// RFC 5789 or MethodOther otherwise so that the number of series is bounded
+func getMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return MethodOther
+}
+
+// getStatusClass returns the class of the :statusCode (eg. 2xx for 200), responses
+// without an explicit status code are treated as 200
+func getStatusClass(statusCode int) string {
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	return fmt.Sprintf("%vxx", statusCode/100)
+}
+
+// countingReadCloser counts the bytes read from the wrapped io.ReadCloser so that the
+// size of requests without a Content-Length can be measured
+type countingReadCloser struct {
+	io.ReadCloser
+	count int64
+}
+
+func (crc *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := crc.ReadCloser.Read(p)
+	crc.count += int64(n)
+	return n, err
+}
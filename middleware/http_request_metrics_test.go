@@ -0,0 +1,301 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/suite"
+	"github.com/usvc/go-server/metrics"
+)
+
+type RequestMetricsTest struct {
+	suite.Suite
+}
+
+func TestRequestMetrics(t *testing.T) {
+	suite.Run(t, &RequestMetricsTest{})
+}
+
+func (s RequestMetricsTest) Test_e2e() {
+	registry := prometheus.NewRegistry()
+	withRequestMetrics := NewRequestMetrics(RequestMetricsConfiguration{
+		Registerer:      registry,
+		DurationBuckets: []float64{1},
+		SizeBuckets:     []float64{10},
+		Route: func(r *http.Request) string {
+			if strings.HasPrefix(r.URL.Path, "/users/") {
+				return "/users/:id"
+			}
+			return ""
+		},
+	})
+	handler := http.NewServeMux()
+	handler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte("hello world"))
+	})
+	server := httptest.NewServer(withRequestMetrics(handler))
+	defer server.Close()
+
+	for _, path := range []string{"/users/1", "/users/2", "/missing"} {
+		request, err := http.NewRequest(http.MethodPost, server.URL+path, bytes.NewBufferString("12345"))
+		s.Nil(err)
+		response, err := http.DefaultClient.Do(request)
+		s.Nil(err)
+		ioutil.ReadAll(response.Body)
+		response.Body.Close()
+	}
+
+	expected := `
+# HELP http_server_requests_total Number of HTTP requests handled
+# TYPE http_server_requests_total counter
+http_server_requests_total{method="POST",route="/users/:id",status="2xx"} 2
+http_server_requests_total{method="POST",route="other",status="4xx"} 1
+# HELP http_server_response_size_bytes Size of HTTP response bodies in bytes
+# TYPE http_server_response_size_bytes histogram
+http_server_response_size_bytes_bucket{method="POST",route="/users/:id",status="2xx",le="10"} 0
+http_server_response_size_bytes_bucket{method="POST",route="/users/:id",status="2xx",le="+Inf"} 2
+http_server_response_size_bytes_sum{method="POST",route="/users/:id",status="2xx"} 22
+http_server_response_size_bytes_count{method="POST",route="/users/:id",status="2xx"} 2
+http_server_response_size_bytes_bucket{method="POST",route="other",status="4xx",le="10"} 0
+http_server_response_size_bytes_bucket{method="POST",route="other",status="4xx",le="+Inf"} 1
+http_server_response_size_bytes_sum{method="POST",route="other",status="4xx"} 11
+http_server_response_size_bytes_count{method="POST",route="other",status="4xx"} 1
+# HELP http_server_request_size_bytes Size of HTTP request bodies in bytes
+# TYPE http_server_request_size_bytes histogram
+http_server_request_size_bytes_bucket{method="POST",route="/users/:id",status="2xx",le="10"} 2
+http_server_request_size_bytes_bucket{method="POST",route="/users/:id",status="2xx",le="+Inf"} 2
+http_server_request_size_bytes_sum{method="POST",route="/users/:id",status="2xx"} 10
+http_server_request_size_bytes_count{method="POST",route="/users/:id",status="2xx"} 2
+http_server_request_size_bytes_bucket{method="POST",route="other",status="4xx",le="10"} 1
+http_server_request_size_bytes_bucket{method="POST",route="other",status="4xx",le="+Inf"} 1
+http_server_request_size_bytes_sum{method="POST",route="other",status="4xx"} 5
+http_server_request_size_bytes_count{method="POST",route="other",status="4xx"} 1
+# HELP http_server_requests_in_flight Number of HTTP requests being handled
+# TYPE http_server_requests_in_flight gauge
+http_server_requests_in_flight 0
+`
+	s.Nil(testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"http_server_requests_total",
+		"http_server_response_size_bytes",
+		"http_server_request_size_bytes",
+		"http_server_requests_in_flight",
+	))
+	count, err := testutil.GatherAndCount(registry, "http_server_request_duration_seconds")
+	s.Nil(err)
+	s.Equal(2, count)
+}
+
+func (s RequestMetricsTest) Test_labelNames() {
+	registry := prometheus.NewRegistry()
+	withRequestMetrics := NewRequestMetrics(RequestMetricsConfiguration{
+		Registerer: registry,
+		LabelNames: RequestMetricsLabelNames{
+			Method: "http_method",
+			Status: "code",
+			Route:  "handler",
+		},
+	})
+	recorder := httptest.NewRecorder()
+	withRequestMetrics(http.NotFoundHandler()).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	expected := `
+# HELP http_server_requests_total Number of HTTP requests handled
+# TYPE http_server_requests_total counter
+http_server_requests_total{code="4xx",handler="other",http_method="GET"} 1
+`
+	s.Nil(testutil.GatherAndCompare(registry, strings.NewReader(expected), "http_server_requests_total"))
+}
+
+func (s RequestMetricsTest) Test_resolvedRoute() {
+	registry := prometheus.NewRegistry()
+	withRequestMetrics := NewRequestMetrics(RequestMetricsConfiguration{Registerer: registry})
+	withRouteResolver := NewRouteResolver(RouteResolverConfiguration{Routes: []string{"/users/:id"}})
+	handler := withRouteResolver(withRequestMetrics(http.NotFoundHandler()))
+	for _, path := range []string{"/users/1", "/users/2", "/unknown/1", "/unknown/2"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	expected := `
+# HELP http_server_requests_total Number of HTTP requests handled
+# TYPE http_server_requests_total counter
+http_server_requests_total{method="GET",route="/users/:id",status="4xx"} 2
+http_server_requests_total{method="GET",route="other",status="4xx"} 2
+`
+	s.Nil(testutil.GatherAndCompare(registry, strings.NewReader(expected), "http_server_requests_total"))
+}
+
+func (s RequestMetricsTest) Test_exemplars() {
+	withRequestIdentifier := NewRequestIdentifier(RequestIdentifierConfiguration{})
+
+	registry := prometheus.NewRegistry()
+	withRequestMetrics := NewRequestMetrics(RequestMetricsConfiguration{Registerer: registry})
+	recorder := httptest.NewRecorder()
+	withRequestIdentifier(withRequestMetrics(http.NotFoundHandler())).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	exemplars := s.getExemplars(registry)
+	s.Len(exemplars, 2)
+	for name, labels := range exemplars {
+		s.Equal(map[string]string{RequestMetricsExemplarRequestID: recorder.Header().Get(DefaultRequestIdentifierHeaderKey)}, labels,
+			"%s should use the request id for untraced requests", name)
+	}
+
+	registry = prometheus.NewRegistry()
+	withRequestMetrics = NewRequestMetrics(RequestMetricsConfiguration{Registerer: registry})
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(RequestMetricsTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	withRequestIdentifier(withRequestMetrics(http.NotFoundHandler())).ServeHTTP(httptest.NewRecorder(), request)
+	exemplars = s.getExemplars(registry)
+	s.Len(exemplars, 2)
+	for name, labels := range exemplars {
+		s.Equal(map[string]string{RequestMetricsExemplarTraceID: "4bf92f3577b34da6a3ce929d0e0e4736"}, labels,
+			"%s should use the trace id for traced requests", name)
+	}
+}
+
+func (s RequestMetricsTest) Test_oversizedExemplars() {
+	registry := prometheus.NewRegistry()
+	withRequestMetrics := NewRequestMetrics(RequestMetricsConfiguration{
+		Registerer: registry,
+		Exemplar: func(r *http.Request) prometheus.Labels {
+			return prometheus.Labels{"too_long": strings.Repeat("a", prometheus.ExemplarMaxRunes)}
+		},
+	})
+	s.NotPanics(func() {
+		withRequestMetrics(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	s.Len(s.getExemplars(registry), 0)
+}
+
+// getExemplars returns the labels of an exemplar of each metric gathered from the
+// :registry
+func (s RequestMetricsTest) getExemplars(registry *prometheus.Registry) map[string]map[string]string {
+	families, err := registry.Gather()
+	s.Nil(err)
+	exemplars := map[string]map[string]string{}
+	for _, family := range families {
+		var exemplar *dto.Exemplar
+		for _, metric := range family.GetMetric() {
+			if metric.GetCounter().GetExemplar() != nil {
+				exemplar = metric.GetCounter().GetExemplar()
+			}
+			for _, bucket := range metric.GetHistogram().GetBucket() {
+				if bucket.GetExemplar() != nil {
+					exemplar = bucket.GetExemplar()
+				}
+			}
+		}
+		if exemplar == nil {
+			continue
+		}
+		exemplars[family.GetName()] = map[string]string{}
+		for _, label := range exemplar.GetLabel() {
+			exemplars[family.GetName()][label.GetName()] = label.GetValue()
+		}
+	}
+	return exemplars
+}
+
+type recordingSink struct {
+	mutex        sync.Mutex
+	measurements []string
+}
+
+func (r *recordingSink) record(kind, name string, tags metrics.Tags) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.measurements = append(r.measurements, fmt.Sprintf("%s %s %v", kind, name, tags))
+}
+
+func (r *recordingSink) Count(name string, value float64, tags metrics.Tags) {
+	r.record("count", name, tags)
+}
+
+func (r *recordingSink) Gauge(name string, value float64, tags metrics.Tags) {
+	r.record(fmt.Sprintf("gauge=%v", value), name, tags)
+}
+
+func (r *recordingSink) Histogram(name string, value float64, tags metrics.Tags) {
+	r.record(fmt.Sprintf("histogram=%v", value), name, tags)
+}
+
+func (r *recordingSink) Timing(name string, value time.Duration, tags metrics.Tags) {
+	r.record("timing", name, tags)
+}
+
+func (s RequestMetricsTest) Test_sink() {
+	sink := &recordingSink{}
+	withRequestMetrics := NewRequestMetrics(RequestMetricsConfiguration{
+		Registerer:  prometheus.NewRegistry(),
+		ConstLabels: prometheus.Labels{"service": "expected-service"},
+		Sink:        sink,
+	})
+	handler := withRequestMetrics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hi")))
+	tags := "map[method:POST route:other service:expected-service status:2xx]"
+	s.Equal([]string{
+		"gauge=1 " + RequestMetricsSinkInFlight + " map[service:expected-service]",
+		"count " + RequestMetricsSinkRequests + " " + tags,
+		"timing " + RequestMetricsSinkDuration + " " + tags,
+		"histogram=2 " + RequestMetricsSinkRequestSize + " " + tags,
+		"histogram=5 " + RequestMetricsSinkResponseSize + " " + tags,
+		"gauge=0 " + RequestMetricsSinkInFlight + " map[service:expected-service]",
+	}, sink.measurements)
+}
+
+func (s RequestMetricsTest) Test_getTraceID() {
+	testCases := map[string]string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01": "",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01":   "",
+		"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01": "",
+		"": "",
+	}
+	for traceParent, expected := range testCases {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set(RequestMetricsTraceParent, traceParent)
+		s.Equal(expected, getTraceID(request), "traceparent: '%s'", traceParent)
+	}
+}
+
+func (s RequestMetricsTest) Test_nonStandardMethods() {
+	registry := prometheus.NewRegistry()
+	sink := &recordingSink{}
+	withRequestMetrics := NewRequestMetrics(RequestMetricsConfiguration{
+		Registerer: registry,
+		Sink:       sink,
+	})
+	handler := withRequestMetrics(http.NotFoundHandler())
+	for _, method := range []string{http.MethodDelete, "PROPFIND", "get", "X-RANDOM-1"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/", nil))
+	}
+	expected := `
+# HELP http_server_requests_total Number of HTTP requests handled
+# TYPE http_server_requests_total counter
+http_server_requests_total{method="DELETE",route="other",status="4xx"} 1
+http_server_requests_total{method="other",route="other",status="4xx"} 3
+`
+	s.Nil(testutil.GatherAndCompare(registry, strings.NewReader(expected), "http_server_requests_total"))
+	s.Contains(sink.measurements, "count "+RequestMetricsSinkRequests+" map[method:other route:other status:4xx]",
+		"sinks should receive the same bounded method")
+}
+
+func (s RequestMetricsTest) Test_getStatusClass() {
+	s.Equal("2xx", getStatusClass(0))
+	s.Equal("2xx", getStatusClass(http.StatusNoContent))
+	s.Equal("3xx", getStatusClass(http.StatusFound))
+	s.Equal("5xx", getStatusClass(http.StatusBadGateway))
+}
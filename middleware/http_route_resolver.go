@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+const (
+	RequestContextRoute = "request_context_route"
+	// RouteOther is the route of requests which do not match any known route
+	RouteOther = "other"
+)
+
+// RouteMatcher is implemented by multiplexers which can return the pattern a request
+// matches, such as *http.ServeMux
+type RouteMatcher interface {
+	Handler(r *http.Request) (h http.Handler, pattern string)
+}
+
+type RouteResolverConfiguration struct {
+	// Normalizer returns the route template of a request, this takes precedence
+	// over the Routes and Mux if it returns a non-empty string
+	Normalizer func(*http.Request) string
+	// Routes is a table of route templates which are matched against the request
+	// path in order. Path segments beginning with ':' or wrapped in braces (eg.
+	// /users/:id or /users/{id}) match any single segment and a final '*' segment
+	// matches the remainder of the path
+	Routes []string
+	// Mux resolves the route from the patterns registered with it, this is used
+	// if the route is not resolved by the Normalizer or Routes
+	Mux RouteMatcher
+}
+
+// NewRouteResolver returns a middleware that resolves the route template of each
+// request and stores it in the request context under RequestContextRoute so that it
+// can be used to label metrics and logs without using the request path. Requests
+// which do not resolve to a route are assigned RouteOther
+func NewRouteResolver(config interface{}) Middleware {
+	conf := config.(RouteResolverConfiguration)
+	routes := make([][]string, 0, len(conf.Routes))
+	for _, route := range conf.Routes {
+		routes = append(routes, splitRoute(route))
+	}
+	resolve := func(r *http.Request) string {
+		if conf.Normalizer != nil {
+			if route := conf.Normalizer(r); len(route) > 0 {
+				return route
+			}
+		}
+		path := splitRoute(r.URL.Path)
+		for i, route := range routes {
+			if matchRoute(route, path) {
+				return conf.Routes[i]
+			}
+		}
+		if conf.Mux != nil {
+			if _, pattern := conf.Mux.Handler(r); len(pattern) > 0 {
+				return pattern
+			}
+		}
+		return RouteOther
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), RequestContextRoute, resolve(r))))
+		})
+	}
+}
+
+// GetRequestRoute returns the route template resolved by NewRouteResolver for the
+// request :r or an empty string if it has not been resolved
+func GetRequestRoute(r *http.Request) string {
+	route, _ := r.Context().Value(RequestContextRoute).(string)
+	return route
+}
+
+// splitRoute returns the segments of the :path
+func splitRoute(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// matchRoute returns true if the :path segments match the :route template segments
+func matchRoute(route, path []string) bool {
+	for i, segment := range route {
+		if segment == "*" && i == len(route)-1 {
+			return true
+		}
+		if i >= len(path) {
+			return false
+		}
+		isParameter := strings.HasPrefix(segment, ":") ||
+			(strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}"))
+		if isParameter {
+			if len(path[i]) == 0 {
+				return false
+			}
+			continue
+		}
+		if segment != path[i] {
+			return false
+		}
+	}
+	return len(route) == len(path)
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RouteResolverTest struct {
+	suite.Suite
+}
+
+func TestRouteResolver(t *testing.T) {
+	suite.Run(t, &RouteResolverTest{})
+}
+
+func (s RouteResolverTest) resolve(config RouteResolverConfiguration, path string) string {
+	route := ""
+	withRouteResolver := NewRouteResolver(config)
+	handler := withRouteResolver(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route = GetRequestRoute(r)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	return route
+}
+
+func (s RouteResolverTest) Test_routes() {
+	config := RouteResolverConfiguration{
+		Routes: []string{
+			"/users/:id",
+			"/users/{id}/posts/{postId}",
+			"/static/*",
+			"/",
+		},
+	}
+	testCases := map[string]string{
+		"/users/1":              "/users/:id",
+		"/users/2/":             "/users/:id",
+		"/users/1/posts/abc":    "/users/{id}/posts/{postId}",
+		"/users/1/posts":        RouteOther,
+		"/users//posts/abc":     RouteOther,
+		"/static/js/app.min.js": "/static/*",
+		"/":                     "/",
+		"/unknown":              RouteOther,
+	}
+	for path, expected := range testCases {
+		s.Equal(expected, s.resolve(config, path), "path: '%s'", path)
+	}
+}
+
+func (s RouteResolverTest) Test_mux() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {})
+	config := RouteResolverConfiguration{Mux: mux}
+	s.Equal("/api/", s.resolve(config, "/api/users/1"))
+	s.Equal("/healthz", s.resolve(config, "/healthz"))
+	s.Equal(RouteOther, s.resolve(config, "/unknown"))
+}
+
+func (s RouteResolverTest) Test_precedence() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	config := RouteResolverConfiguration{
+		Normalizer: func(r *http.Request) string {
+			if strings.HasPrefix(r.URL.Path, "/v1/") {
+				return "/v1/..."
+			}
+			return ""
+		},
+		Routes: []string{"/v1/:resource", "/v2/:resource"},
+		Mux:    mux,
+	}
+	s.Equal("/v1/...", s.resolve(config, "/v1/users"), "the normalizer should take precedence")
+	s.Equal("/v2/:resource", s.resolve(config, "/v2/users"), "the route table should take precedence over the mux")
+	s.Equal("/", s.resolve(config, "/v3/users"))
+}
+
+func (s RouteResolverTest) Test_GetRequestRoute() {
+	s.Equal("", GetRequestRoute(httptest.NewRequest(http.MethodGet, "/", nil)))
+}
@@ -1,14 +1,28 @@
 package types
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"time"
+)
 
 type HTTPProbeHandler func() error
 type HTTPProbeHandlers []HTTPProbeHandler
 
+// WithContext adapts the handler into a HTTPProbeContextHandler which ignores its context
+func (httpph HTTPProbeHandler) WithContext() HTTPProbeContextHandler {
+	return func(context.Context) error {
+		return httpph()
+	}
+}
+
+// HTTPProbeContextHandler is a probe handler which receives the context of the probe
+// request with the check's timeout applied, handlers should return once it is done
+type HTTPProbeContextHandler func(context.Context) error
+
 func (httpph HTTPProbeHandlers) Do() []error {
 	errors := []error{}
 	for _, handler := range httpph {
-		fmt.Println("hi")
 		if err := handler(); err != nil {
 			errors = append(errors, err)
 		}
@@ -18,3 +32,86 @@ func (httpph HTTPProbeHandlers) Do() []error {
 	}
 	return errors
 }
+
+// HTTPProbeCheck is a named probe handler with an optional timeout, use its Do
+// method to add it to HTTPProbeHandlers
+type HTTPProbeCheck struct {
+	// Name identifies the check in the errors it returns and in metrics, checks
+	// without a name do not prefix their errors and are not exported as metrics
+	Name string
+	// Timeout is the duration after which the check is considered failed, no
+	// timeout is applied when this is zero
+	Timeout time.Duration
+	// Handler performs the check, this is ignored if ContextHandler is defined
+	Handler HTTPProbeHandler
+	// ContextHandler performs the check with the context of the probe request
+	ContextHandler HTTPProbeContextHandler
+	// NonCritical when set causes a failure of this check to degrade the probe
+	// instead of failing it
+	NonCritical bool
+	// FailureThreshold is the number of consecutive failures after which a
+	// passing check is considered failed, defaults to 1. Thresholds only apply
+	// after the first run of a check which determines its initial state
+	FailureThreshold int
+	// SuccessThreshold is the number of consecutive successes after which a
+	// failed check is considered passing again, defaults to 1
+	SuccessThreshold int
+}
+
+// Do runs the check without a parent context, it implements HTTPProbeHandler so that
+// checks can be added to HTTPProbeHandlers
+func (httppc HTTPProbeCheck) Do() error {
+	return httppc.DoContext(context.Background())
+}
+
+// DoContext runs the check with a context derived from :ctx which expires after the
+// check's timeout. It returns an error prefixed with the check's name if the check
+// failed or did not complete before the context was done. ContextHandler is called
+// directly and is expected to return once the context is done, while Handler which
+// cannot observe the context is run in a goroutine that outlives the check if the
+// handler never returns
+func (httppc HTTPProbeCheck) DoContext(ctx context.Context) error {
+	checkContext := ctx
+	if httppc.Timeout > 0 {
+		var cancel context.CancelFunc
+		checkContext, cancel = context.WithTimeout(ctx, httppc.Timeout)
+		defer cancel()
+	}
+	var err error
+	if httppc.ContextHandler != nil {
+		err = httppc.ContextHandler(checkContext)
+	} else {
+		err = doWithoutContext(checkContext, httppc.Handler)
+	}
+	if err != nil && checkContext.Err() != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("aborted: %s", ctx.Err())
+		} else {
+			err = fmt.Errorf("timed out after %s", httppc.Timeout)
+		}
+	}
+	if err != nil && len(httppc.Name) > 0 {
+		return fmt.Errorf("%s: %s", httppc.Name, err)
+	}
+	return err
+}
+
+// doWithoutContext runs the :handler and returns its error or the error of :ctx if it
+// is done first, the handler is left running in its goroutine in the latter case
+func doWithoutContext(ctx context.Context, handler HTTPProbeHandler) error {
+	if ctx.Done() == nil {
+		return handler()
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- handler()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type HTTPProbeChecks []HTTPProbeCheck
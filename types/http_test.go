@@ -1,8 +1,10 @@
 package types
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/suite"
 )
@@ -44,3 +46,70 @@ func (s HTTPTests) Test_HTTPProbeHandlers() {
 	s.Equal("first", errors[0].Error())
 	s.Equal("second", errors[1].Error())
 }
+
+func (s HTTPTests) Test_HTTPProbeCheck() {
+	check := HTTPProbeCheck{
+		Name:    "expected",
+		Handler: func() error { return nil },
+	}
+	s.Nil(check.Do())
+
+	check.Handler = func() error { return fmt.Errorf("failed") }
+	s.EqualError(check.Do(), "expected: failed")
+
+	check.Timeout = time.Millisecond
+	check.Handler = func() error {
+		<-time.After(100 * time.Millisecond)
+		return nil
+	}
+	s.EqualError(check.Do(), "expected: timed out after 1ms")
+
+	handlers := HTTPProbeHandlers{check.Do}
+	s.Len(handlers.Do(), 1)
+
+	check.Name = ""
+	s.EqualError(check.Do(), "timed out after 1ms")
+	check.Handler = func() error { return fmt.Errorf("unnamed") }
+	s.EqualError(check.Do(), "unnamed")
+}
+
+func (s HTTPTests) Test_HTTPProbeCheck_DoContext() {
+	type contextKey string
+	var received context.Context
+	check := HTTPProbeCheck{
+		Name:    "expected",
+		Timeout: time.Second,
+		ContextHandler: func(ctx context.Context) error {
+			received = ctx
+			return nil
+		},
+		Handler: func() error { return fmt.Errorf("should not be called") },
+	}
+	ctx := context.WithValue(context.Background(), contextKey("key"), "value")
+	s.Nil(check.DoContext(ctx))
+	s.Equal("value", received.Value(contextKey("key")))
+	_, hasDeadline := received.Deadline()
+	s.True(hasDeadline, "the check's timeout should be applied")
+
+	stopped := make(chan bool, 1)
+	check.ContextHandler = func(ctx context.Context) error {
+		<-ctx.Done()
+		stopped <- true
+		return ctx.Err()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.EqualError(check.DoContext(ctx), "expected: aborted: context canceled")
+	s.True(<-stopped, "the handler should be able to stop once the context is done")
+
+	check.Timeout = time.Millisecond
+	s.EqualError(check.DoContext(context.Background()), "expected: timed out after 1ms")
+
+	legacyCalled := false
+	legacy := HTTPProbeHandler(func() error {
+		legacyCalled = true
+		return nil
+	})
+	s.Nil(legacy.WithContext()(context.Background()))
+	s.True(legacyCalled)
+}